@@ -0,0 +1,248 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AssertRequestHeaders fails t unless the request at index carried every
+// header in want with the given value. An empty value only requires the
+// header to be present.
+func (s *Server) AssertRequestHeaders(t testing.TB, index int, want map[string]string) {
+	t.Helper()
+
+	request, ok := s.recordedRequestNum(index)
+	if !ok {
+		t.Fatalf("Expected a request at index %d, only %d were recorded", index, s.RequestCount())
+		return
+	}
+
+	header := request.header
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mismatches := []string{}
+	for _, name := range names {
+		values, present := header[http.CanonicalHeaderKey(name)]
+		switch {
+		case !present:
+			mismatches = append(mismatches, name+": missing")
+		case want[name] != "" && values[0] != want[name]:
+			mismatches = append(mismatches, name+": expected "+want[name]+", got "+values[0])
+		}
+	}
+
+	if len(mismatches) > 0 {
+		t.Errorf("Request %d headers did not match:\n%s", index, strings.Join(mismatches, "\n"))
+	}
+}
+
+// AssertRequestHeaderAbsent fails t if the request at index carried the
+// headerName header, even with an empty value.
+func (s *Server) AssertRequestHeaderAbsent(t testing.TB, index int, headerName string) {
+	t.Helper()
+
+	request, ok := s.recordedRequestNum(index)
+	if !ok {
+		t.Fatalf("Expected a request at index %d, only %d were recorded", index, s.RequestCount())
+		return
+	}
+
+	if values, present := request.header[http.CanonicalHeaderKey(headerName)]; present {
+		t.Errorf("Request %d: expected no %s header, got %q", index, headerName, values)
+	}
+}
+
+// AssertRequestBodyIsJSON fails t unless the body of the request at index is
+// well-formed JSON.
+func (s *Server) AssertRequestBodyIsJSON(t testing.TB, index int) {
+	t.Helper()
+
+	request, ok := s.recordedRequestNum(index)
+	if !ok {
+		t.Fatalf("Expected a request at index %d, only %d were recorded", index, s.RequestCount())
+		return
+	}
+
+	var value interface{}
+	err := json.Unmarshal(request.body, &value)
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		t.Errorf("Request %d body is not valid JSON at offset %d: %s", index, syntaxErr.Offset, syntaxErr)
+		return
+	}
+	if err != nil {
+		t.Errorf("Request %d body is not valid JSON: %s", index, err)
+	}
+}
+
+// AssertRequestJSONPath fails t unless the value at path in the JSON body of
+// the request at index equals want. path is a dotted list of object keys and
+// array indexes, such as "items.0.name". want is compared after a round trip
+// through encoding/json, so numbers of any type compare to the decoded value.
+func (s *Server) AssertRequestJSONPath(t testing.TB, index int, path string, want interface{}) {
+	t.Helper()
+
+	request, ok := s.recordedRequestNum(index)
+	if !ok {
+		t.Fatalf("Expected a request at index %d, only %d were recorded", index, s.RequestCount())
+		return
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(request.body, &body); err != nil {
+		t.Errorf("Request %d body is not valid JSON: %s", index, err)
+		return
+	}
+
+	got, err := jsonPath(body, path)
+	if err != nil {
+		t.Errorf("Request %d body has no value at %s: %s", index, path, err)
+		return
+	}
+
+	expected, err := normalizeJSON(want)
+	if err != nil {
+		t.Errorf("Expected value for %s can't be encoded as JSON: %s", path, err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Request %d body at %s: expected %v, got %v", index, path, expected, got)
+	}
+}
+
+func jsonPath(value interface{}, path string) (interface{}, error) {
+	for _, segment := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			next, ok := current[segment]
+			if !ok {
+				return nil, errors.Errorf("key %q not found", segment)
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, errors.Errorf("%q is not an array index", segment)
+			}
+			if i < 0 || i >= len(current) {
+				return nil, errors.Errorf("index %d out of range for array of length %d", i, len(current))
+			}
+			value = current[i]
+		default:
+			return nil, errors.Errorf("can't look up %q in %v", segment, current)
+		}
+	}
+
+	return value, nil
+}
+
+func normalizeJSON(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	err = json.Unmarshal(encoded, &normalized)
+	return normalized, err
+}
+
+// AssertRequestWithin fails t unless a request for method and path has
+// arrived by d after the call, blocking until it does or d elapses. Requests
+// recorded before the call count too.
+func (s *Server) AssertRequestWithin(t testing.TB, method, path string, d time.Duration) {
+	t.Helper()
+
+	if _, ok := s.WaitForRequest(method, path, d); !ok {
+		t.Errorf("Expected a %s %s request within %s, none arrived", strings.ToUpper(method), path, d)
+	}
+}
+
+func (s *Server) recordedRequestNum(index int) (*recordedRequest, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if index < 0 || index >= len(s.requests) {
+		return nil, false
+	}
+
+	return s.requests[index], true
+}
+
+// AssertNoUnexpectedRequests fails t if any recorded request did not match a
+// registered route, that is if it was answered with a 404 or 405.
+func (s *Server) AssertNoUnexpectedRequests(t testing.TB) {
+	t.Helper()
+
+	s.lock.RLock()
+	unexpected := []string{}
+	for i, request := range s.requests {
+		if request.received && !request.matched {
+			unexpected = append(unexpected, fmt.Sprintf("%d: %s %s", i, request.request.Method, request.request.URL.Path))
+		}
+	}
+	s.lock.RUnlock()
+
+	if len(unexpected) > 0 {
+		t.Errorf("Unexpected requests:\n%s", strings.Join(unexpected, "\n"))
+	}
+}
+
+// Call is a method and path, as a request is expected to be made.
+type Call struct {
+	Method string
+	Path   string
+}
+
+func (c Call) String() string {
+	return strings.ToUpper(c.Method) + " " + c.Path
+}
+
+// AssertExactSequence fails t unless the recorded requests are exactly
+// calls, in order, with nothing before, between or after them. Methods are
+// compared ignoring case.
+func (s *Server) AssertExactSequence(t testing.TB, calls ...Call) {
+	t.Helper()
+
+	s.lock.RLock()
+	recorded := make([]Call, 0, len(s.requests))
+	for _, request := range s.requests {
+		recorded = append(recorded, Call{Method: request.request.Method, Path: request.request.URL.Path})
+	}
+	s.lock.RUnlock()
+
+	matches := len(recorded) == len(calls)
+	for i := 0; matches && i < len(calls); i++ {
+		matches = strings.EqualFold(recorded[i].Method, calls[i].Method) && recorded[i].Path == calls[i].Path
+	}
+
+	if !matches {
+		t.Errorf("Expected requests:\n%s\nGot:\n%s", formatCalls(calls), formatCalls(recorded))
+	}
+}
+
+func formatCalls(calls []Call) string {
+	if len(calls) == 0 {
+		return "(none)"
+	}
+
+	lines := make([]string, 0, len(calls))
+	for i, call := range calls {
+		lines = append(lines, fmt.Sprintf("%d: %s", i, call))
+	}
+	return strings.Join(lines, "\n")
+}
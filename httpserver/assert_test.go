@@ -0,0 +1,327 @@
+package httpserver_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+type fakeTB struct {
+	testing.TB
+	failures []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Cleanup(cleanup func()) {
+	f.cleanups = append(f.cleanups, cleanup)
+}
+
+// finish runs the registered cleanups, as the testing package does when a
+// test ends.
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Failed() bool {
+	return len(f.failures) > 0
+}
+
+func makeRequestWithHeaders(t *testing.T, server *httpserver.Server, method, path string, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.Addr()+path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header = header
+
+	c := http.Client{}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return resp
+}
+
+func TestAssertRequestHeaders(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequestWithHeaders(t, server, "GET", "/hello", http.Header{
+		"Authorization": []string{"Bearer token"},
+		"X-Request-Id":  []string{"abc"},
+	})
+
+	t.Run("Matching", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertRequestHeaders(tb, 0, map[string]string{
+			"authorization": "Bearer token",
+			"X-Request-Id":  "",
+		})
+
+		if tb.Failed() {
+			t.Fatalf("Expected assertion to pass, it failed with: %v", tb.failures)
+		}
+	})
+
+	t.Run("Mismatching", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertRequestHeaders(tb, 0, map[string]string{
+			"Authorization": "Bearer other",
+			"X-Missing":     "",
+		})
+
+		if !tb.Failed() {
+			t.Fatal("Expected assertion to fail")
+		}
+		for _, expected := range []string{"Authorization: expected Bearer other, got Bearer token", "X-Missing: missing"} {
+			if !strings.Contains(tb.failures[0], expected) {
+				t.Fatalf("Expected failure to contain %q, got: %s", expected, tb.failures[0])
+			}
+		}
+	})
+
+	t.Run("MissingRequest", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertRequestHeaders(tb, 1, map[string]string{})
+
+		if !tb.Failed() {
+			t.Fatal("Expected assertion to fail")
+		}
+	})
+}
+
+func TestAssertRequestHeaderAbsent(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequestWithHeaders(t, server, "GET", "/hello", http.Header{
+		"Authorization": []string{"Bearer token"},
+	})
+
+	cases := []struct {
+		Name           string
+		Header         string
+		ExpectedFailed bool
+	}{
+		{"Present", "authorization", true},
+		{"Absent", "Cookie", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tb := &fakeTB{}
+			server.AssertRequestHeaderAbsent(tb, 0, tc.Header)
+
+			if tb.Failed() != tc.ExpectedFailed {
+				t.Fatalf("Expected assertion failed to be %t, it was %t: %v", tc.ExpectedFailed, tb.Failed(), tb.failures)
+			}
+		})
+	}
+
+	t.Run("MissingRequest", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertRequestHeaderAbsent(tb, 1, "Authorization")
+
+		if !tb.Failed() {
+			t.Fatal("Expected assertion to fail")
+		}
+	})
+}
+
+func TestAssertRequestBodyIsJSON(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequestWithBody(t, server, "POST", "/json", []byte(`{"user": {"id": 1}, "tags": ["a"]}`))
+	makeRequestWithBody(t, server, "POST", "/json", []byte(`{"user": {"id": 1,}}`))
+
+	t.Run("Valid", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertRequestBodyIsJSON(tb, 0)
+
+		if tb.Failed() {
+			t.Fatalf("Expected assertion to pass, it failed with: %v", tb.failures)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertRequestBodyIsJSON(tb, 1)
+
+		if !tb.Failed() {
+			t.Fatal("Expected assertion to fail")
+		}
+		if !strings.Contains(tb.failures[0], "offset 19") {
+			t.Fatalf("Expected failure to report the offset, got: %s", tb.failures[0])
+		}
+	})
+}
+
+func TestAssertRequestJSONPath(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequestWithBody(t, server, "POST", "/json", []byte(`{"user": {"id": 7, "name": "ann"}, "items": [{"name": "first"}, {"name": "second"}], "paid": true}`))
+
+	cases := []struct {
+		Name           string
+		Path           string
+		Want           interface{}
+		ExpectedFailed bool
+		ExpectedError  string
+	}{
+		{"NestedNumber", "user.id", 7, false, ""},
+		{"NestedString", "user.name", "ann", false, ""},
+		{"ArrayIndex", "items.1.name", "second", false, ""},
+		{"Bool", "paid", true, false, ""},
+		{"Object", "items.0", map[string]string{"name": "first"}, false, ""},
+		{"Mismatch", "user.name", "bob", true, "expected bob, got ann"},
+		{"MissingKey", "user.email", "ann", true, `key "email" not found`},
+		{"OutOfRange", "items.5.name", "x", true, "index 5 out of range"},
+		{"NotAnIndex", "items.first", "x", true, `"first" is not an array index`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tb := &fakeTB{}
+			server.AssertRequestJSONPath(tb, 0, tc.Path, tc.Want)
+
+			if tb.Failed() != tc.ExpectedFailed {
+				t.Fatalf("Expected assertion failed to be %t, it was %t: %v", tc.ExpectedFailed, tb.Failed(), tb.failures)
+			}
+			if tc.ExpectedFailed && !strings.Contains(tb.failures[0], tc.ExpectedError) {
+				t.Fatalf("Expected failure to contain %q, got: %s", tc.ExpectedError, tb.failures[0])
+			}
+		})
+	}
+}
+
+func TestAssertRequestWithin(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	t.Run("InTime", func(t *testing.T) {
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			resp, err := http.Post(server.Addr()+"/ping", "text/plain", nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+
+		tb := &fakeTB{}
+		server.AssertRequestWithin(tb, "POST", "/ping", time.Second)
+
+		if tb.Failed() {
+			t.Fatalf("Expected assertion to pass, it failed with: %v", tb.failures)
+		}
+	})
+
+	t.Run("TimesOut", func(t *testing.T) {
+		start := time.Now()
+		tb := &fakeTB{}
+		server.AssertRequestWithin(tb, "GET", "/never", 50*time.Millisecond)
+
+		if !tb.Failed() {
+			t.Fatal("Expected assertion to fail")
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("Expected assertion to wait %s, it returned after %s", 50*time.Millisecond, elapsed)
+		}
+		if !strings.Contains(tb.failures[0], "GET /never") {
+			t.Fatalf("Expected failure to name the request, got: %s", tb.failures[0])
+		}
+	})
+}
+
+func TestAssertNoUnexpectedRequests(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("GET", "/expected", http.StatusOK, []byte{})
+
+	makeRequest(t, server, "GET", "/expected")
+
+	t.Run("Clean", func(t *testing.T) {
+		tb := &fakeTB{}
+		server.AssertNoUnexpectedRequests(tb)
+
+		if tb.Failed() {
+			t.Fatalf("Expected assertion to pass, it failed with: %v", tb.failures)
+		}
+	})
+
+	t.Run("Unexpected", func(t *testing.T) {
+		makeRequest(t, server, "GET", "/unexpected")
+		makeRequest(t, server, "POST", "/expected")
+
+		tb := &fakeTB{}
+		server.AssertNoUnexpectedRequests(tb)
+
+		if !tb.Failed() {
+			t.Fatal("Expected assertion to fail")
+		}
+		for _, expected := range []string{"1: GET /unexpected", "2: POST /expected"} {
+			if !strings.Contains(tb.failures[0], expected) {
+				t.Fatalf("Expected failure to contain %q, got: %s", expected, tb.failures[0])
+			}
+		}
+	})
+}
+
+func TestAssertExactSequence(t *testing.T) {
+	cases := []struct {
+		Name           string
+		Calls          []httpserver.Call
+		ExpectedFailed bool
+	}{
+		{"Exact", []httpserver.Call{{"POST", "/login"}, {"get", "/profile"}, {"POST", "/logout"}}, false},
+		{"ExtraCall", []httpserver.Call{{"POST", "/login"}, {"POST", "/logout"}}, true},
+		{"MissingCall", []httpserver.Call{{"POST", "/login"}, {"GET", "/profile"}, {"GET", "/settings"}, {"POST", "/logout"}}, true},
+		{"WrongOrder", []httpserver.Call{{"GET", "/profile"}, {"POST", "/login"}, {"POST", "/logout"}}, true},
+	}
+
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequest(t, server, "POST", "/login")
+	makeRequest(t, server, "GET", "/profile")
+	makeRequest(t, server, "POST", "/logout")
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tb := &fakeTB{}
+			server.AssertExactSequence(tb, tc.Calls...)
+
+			if tb.Failed() != tc.ExpectedFailed {
+				t.Fatalf("Expected assertion failed to be %t, it was %t: %v", tc.ExpectedFailed, tb.Failed(), tb.failures)
+			}
+			if tc.ExpectedFailed && !strings.Contains(tb.failures[0], "1: GET /profile") {
+				t.Fatalf("Expected failure to list the recorded requests, got: %s", tb.failures[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package httpserver
+
+import "time"
+
+// Clock tells the time to the server's time-based features: timed switches,
+// degrading routes, request timestamps and Uptime. Delays and handler
+// durations always use real time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock makes the server tell the time with clock instead of the system
+// clock, so tests can drive time-based features without sleeping. Routes
+// registered before the call keep the time they were registered at. It
+// survives Reset.
+func (s *Server) SetClock(clock Clock) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clock = clock
+}
+
+func (s *Server) now() time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.clock.Now()
+}
@@ -0,0 +1,57 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestSetClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	server := httpserver.New()
+	server.SetClock(clock)
+	server.Start()
+	defer server.Stop()
+
+	before := httpserver.Response{StatusCode: http.StatusOK, Body: []byte("before")}
+	after := httpserver.Response{StatusCode: http.StatusOK, Body: []byte("after")}
+	server.RegisterTimedSwitch("GET", "/switch", before, after, time.Hour)
+
+	resp := makeRequest(t, server, "GET", "/switch")
+	compareResponse(t, resp, http.StatusOK, []byte("before"))
+
+	clock.Advance(time.Hour)
+
+	resp = makeRequest(t, server, "GET", "/switch")
+	compareResponse(t, resp, http.StatusOK, []byte("after"))
+
+	if !server.StartedAt().Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected start time to come from the clock, it was %s", server.StartedAt())
+	}
+	if server.Uptime() != time.Hour {
+		t.Fatalf("Expected uptime to be %s, it was %s", time.Hour, server.Uptime())
+	}
+}
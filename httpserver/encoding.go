@@ -0,0 +1,132 @@
+package httpserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiableEncodings are the content codings RegisterNegotiatedEncoding can
+// produce, in order of preference when the client weighs them equally.
+var negotiableEncodings = []string{"gzip", "deflate", "identity"}
+
+// RegisterNegotiatedEncoding responds with statusCode and payload encoded
+// with the coding the request's Accept-Encoding ranks highest among gzip,
+// deflate and identity, honouring q-values and "*". identity is used when
+// nothing else is acceptable, unless the client excludes it with q=0, in
+// which case the response is a 406.
+func (s *Server) RegisterNegotiatedEncoding(method, path string, statusCode int, payload []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Add("Vary", "Accept-Encoding")
+
+		encoding, ok := negotiateEncoding(r.Header.Values("Accept-Encoding"))
+		if !ok {
+			rw.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		body, err := encode(encoding, payload)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		if encoding != "identity" {
+			rw.Header().Set("Content-Encoding", encoding)
+		}
+		rw.WriteHeader(statusCode)
+		rw.Write(body)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// negotiateEncoding picks the negotiable encoding with the highest q-value in
+// the Accept-Encoding header values, or false if none is acceptable.
+func negotiateEncoding(values []string) (string, bool) {
+	weights := map[string]float64{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			coding, q := parseCoding(item)
+			if coding != "" {
+				weights[coding] = q
+			}
+		}
+	}
+
+	weight := func(coding string) float64 {
+		if q, ok := weights[coding]; ok {
+			return q
+		}
+		if q, ok := weights["*"]; ok {
+			return q
+		}
+		if coding == "identity" {
+			// Not mentioned at all: acceptable, but only as a last resort.
+			return 0.0001
+		}
+		return 0
+	}
+
+	best, bestWeight := "", 0.0
+	for _, coding := range negotiableEncodings {
+		if q := weight(coding); q > bestWeight {
+			best, bestWeight = coding, q
+		}
+	}
+
+	return best, best != ""
+}
+
+// parseCoding parses a single Accept-Encoding element such as "gzip;q=0.5",
+// returning the lowercased coding and its q-value, 1 if not given.
+func parseCoding(item string) (string, float64) {
+	parts := strings.Split(item, ";")
+	coding := strings.ToLower(strings.TrimSpace(parts[0]))
+
+	q := 1.0
+	for _, param := range parts[1:] {
+		pair := strings.SplitN(param, "=", 2)
+		if len(pair) != 2 || strings.ToLower(strings.TrimSpace(pair[0])) != "q" {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(pair[1]), 64)
+		if err != nil {
+			parsed = 0
+		}
+		q = parsed
+	}
+
+	return coding, q
+}
+
+func encode(encoding string, payload []byte) ([]byte, error) {
+	var (
+		buf    bytes.Buffer
+		writer io.WriteCloser
+	)
+
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	default:
+		return payload, nil
+	}
+
+	if _, err := writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
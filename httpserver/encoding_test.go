@@ -0,0 +1,90 @@
+package httpserver_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestRegisterNegotiatedEncoding(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	payload := []byte("negotiated payload")
+	server.RegisterNegotiatedEncoding("GET", "/data", http.StatusOK, payload)
+
+	cases := []struct {
+		Name             string
+		AcceptEncoding   string
+		ExpectedStatus   int
+		ExpectedEncoding string
+	}{
+		{"None", "", http.StatusOK, ""},
+		{"GzipPreferred", "deflate;q=0.5, gzip;q=0.9", http.StatusOK, "gzip"},
+		{"DeflatePreferred", "gzip;q=0.2, deflate", http.StatusOK, "deflate"},
+		{"EqualWeights", "deflate, gzip", http.StatusOK, "gzip"},
+		{"Wildcard", "*", http.StatusOK, "gzip"},
+		{"GzipExcluded", "gzip;q=0, *", http.StatusOK, "deflate"},
+		{"UnsupportedOnly", "br", http.StatusOK, ""},
+		{"IdentityPreferred", "identity, gzip;q=0.5", http.StatusOK, ""},
+		{"IdentityForbidden", "br, identity;q=0", http.StatusNotAcceptable, ""},
+		{"WildcardForbidden", "*;q=0", http.StatusNotAcceptable, ""},
+		{"IdentityForbiddenGzipAllowed", "gzip, identity;q=0", http.StatusOK, "gzip"},
+	}
+
+	client := http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", server.Addr()+"/data", nil)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if tc.AcceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.AcceptEncoding)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.ExpectedStatus {
+				t.Fatalf("Expected status code to be %d but it was %d", tc.ExpectedStatus, resp.StatusCode)
+			}
+			if encoding := resp.Header.Get("Content-Encoding"); encoding != tc.ExpectedEncoding {
+				t.Fatalf("Expected Content-Encoding to be %q, it was %q", tc.ExpectedEncoding, encoding)
+			}
+			if tc.ExpectedStatus != http.StatusOK {
+				return
+			}
+
+			var body io.Reader = resp.Body
+			switch tc.ExpectedEncoding {
+			case "gzip":
+				body, err = gzip.NewReader(resp.Body)
+			case "deflate":
+				body, err = zlib.NewReader(resp.Body)
+			}
+			if err != nil {
+				t.Fatalf("Unexpected err: %s", err)
+			}
+
+			decoded, err := ioutil.ReadAll(body)
+			if err != nil {
+				t.Fatalf("Unexpected err: %s", err)
+			}
+			if !bytes.Equal(decoded, payload) {
+				t.Fatalf("Expected decoded body to be %s, it was %s", payload, decoded)
+			}
+		})
+	}
+}
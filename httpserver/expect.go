@@ -0,0 +1,124 @@
+package httpserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// atLeastOnce is the count of an expectation set with ExpectCall.
+const atLeastOnce = -1
+
+type expectation struct {
+	method string
+	path   string
+	times  int
+}
+
+func (e *expectation) String() string {
+	return strings.ToUpper(e.method) + " " + e.path
+}
+
+// ExpectCall expects method and path to be requested at least once before
+// AssertExpectations or WaitForExpectations. Expectations are cleared by
+// Reset.
+func (s *Server) ExpectCall(method, path string) {
+	s.expect(method, path, atLeastOnce)
+}
+
+// ExpectCallTimes expects method and path to be requested exactly n times.
+// Both fewer and more calls fail AssertExpectations.
+func (s *Server) ExpectCallTimes(method, path string, n int) {
+	s.expect(method, path, n)
+}
+
+func (s *Server) expect(method, path string, times int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expectations = append(s.expectations, &expectation{method: method, path: path, times: times})
+}
+
+// AssertExpectations fails t for every expectation that the requests
+// received so far don't meet.
+func (s *Server) AssertExpectations(t testing.TB) {
+	t.Helper()
+
+	s.lock.RLock()
+	failures := []string{}
+	for _, e := range s.expectations {
+		calls := s.callsFor(e)
+
+		switch {
+		case e.times == atLeastOnce && calls == 0:
+			failures = append(failures, fmt.Sprintf("%s: expected at least one call, got none", e))
+		case e.times != atLeastOnce && calls != e.times:
+			failures = append(failures, fmt.Sprintf("%s: expected %d calls, got %d", e, e.times, calls))
+		}
+	}
+	s.lock.RUnlock()
+
+	if len(failures) > 0 {
+		t.Errorf("Unmet expectations:\n%s", strings.Join(failures, "\n"))
+	}
+}
+
+// WaitForExpectations blocks until every expectation has had at least as many
+// calls as it expects, or timeout elapses, and then asserts them as
+// AssertExpectations does.
+func (s *Server) WaitForExpectations(t testing.TB, timeout time.Duration) {
+	t.Helper()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+wait:
+	for {
+		arrived, done := s.expectationsReached()
+		if done {
+			break
+		}
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			break wait
+		}
+	}
+
+	s.AssertExpectations(t)
+}
+
+// expectationsReached reports whether every expectation has had enough calls,
+// returning a channel closed on the next received request when they haven't.
+func (s *Server) expectationsReached() (chan struct{}, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, e := range s.expectations {
+		wanted := e.times
+		if wanted == atLeastOnce {
+			wanted = 1
+		}
+
+		if s.callsFor(e) < wanted {
+			return s.arrived, false
+		}
+	}
+
+	return nil, true
+}
+
+// callsFor counts the received requests that e expects. It must be called
+// with the lock held.
+func (s *Server) callsFor(e *expectation) int {
+	calls := 0
+	for _, request := range s.requests {
+		if request.received && strings.EqualFold(request.request.Method, e.method) && request.request.URL.Path == e.path {
+			calls++
+		}
+	}
+
+	return calls
+}
@@ -0,0 +1,121 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestExpectCallTimes(t *testing.T) {
+	cases := []struct {
+		Name           string
+		Calls          int
+		ExpectedFailed bool
+		ExpectedError  string
+	}{
+		{"Exact", 2, false, ""},
+		{"Under", 1, true, "POST /orders: expected 2 calls, got 1"},
+		{"Over", 3, true, "POST /orders: expected 2 calls, got 3"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httpserver.New()
+			server.Start()
+			defer server.Stop()
+
+			server.ExpectCallTimes("POST", "/orders", 2)
+			for i := 0; i < tc.Calls; i++ {
+				makeRequest(t, server, "POST", "/orders")
+			}
+			makeRequest(t, server, "GET", "/orders")
+
+			tb := &fakeTB{}
+			server.AssertExpectations(tb)
+
+			if tb.Failed() != tc.ExpectedFailed {
+				t.Fatalf("Expected assertion failed to be %t, it was %t: %v", tc.ExpectedFailed, tb.Failed(), tb.failures)
+			}
+			if tc.ExpectedFailed && !strings.Contains(tb.failures[0], tc.ExpectedError) {
+				t.Fatalf("Expected failure to contain %q, got: %s", tc.ExpectedError, tb.failures[0])
+			}
+		})
+	}
+}
+
+func TestExpectCall(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.ExpectCall("GET", "/health")
+
+	tb := &fakeTB{}
+	server.AssertExpectations(tb)
+	if !tb.Failed() || !strings.Contains(tb.failures[0], "GET /health: expected at least one call, got none") {
+		t.Fatalf("Expected assertion to fail for the missing call, got: %v", tb.failures)
+	}
+
+	makeRequest(t, server, "GET", "/health")
+	makeRequest(t, server, "GET", "/health")
+
+	tb = &fakeTB{}
+	server.AssertExpectations(tb)
+	if tb.Failed() {
+		t.Fatalf("Expected assertion to pass, it failed with: %v", tb.failures)
+	}
+
+	t.Run("Reset", func(t *testing.T) {
+		server.Reset()
+
+		tb := &fakeTB{}
+		server.AssertExpectations(tb)
+		if tb.Failed() {
+			t.Fatalf("Expected no expectations after Reset, got: %v", tb.failures)
+		}
+	})
+}
+
+func TestWaitForExpectations(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.ExpectCallTimes("POST", "/events", 2)
+
+	t.Run("Satisfied", func(t *testing.T) {
+		go func() {
+			for i := 0; i < 2; i++ {
+				time.Sleep(10 * time.Millisecond)
+				resp, err := http.Post(server.Addr()+"/events", "text/plain", nil)
+				if err == nil {
+					resp.Body.Close()
+				}
+			}
+		}()
+
+		tb := &fakeTB{}
+		server.WaitForExpectations(tb, time.Second)
+		if tb.Failed() {
+			t.Fatalf("Expected expectations to be met, got: %v", tb.failures)
+		}
+	})
+
+	t.Run("TimesOut", func(t *testing.T) {
+		server.ExpectCall("GET", "/never")
+
+		start := time.Now()
+		tb := &fakeTB{}
+		server.WaitForExpectations(tb, 50*time.Millisecond)
+
+		if !tb.Failed() {
+			t.Fatal("Expected expectations to fail")
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("Expected to wait %s, returned after %s", 50*time.Millisecond, elapsed)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync"
+)
+
+// gate holds requests until they are released, in arrival order. Releases
+// that come before any request is waiting are kept for the next ones.
+type gate struct {
+	lock     sync.Mutex
+	waiting  []chan Response
+	released []Response
+}
+
+// RegisterGated records requests for method and path and holds them without
+// responding until the returned release function is called. Each call to
+// release answers the oldest held request with statusCode and payload, or the
+// next one to arrive if none is held. Held requests are dropped if the client
+// gives up or the server is stopped.
+func (s *Server) RegisterGated(method, path string) (release func(statusCode int, payload []byte)) {
+	g := &gate{}
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		wait := g.wait()
+
+		select {
+		case resp := <-wait:
+			resp.ServeHTTP(rw, r)
+		case <-r.Context().Done():
+			g.abandon(wait)
+		case <-s.stopped:
+			g.abandon(wait)
+		}
+	}
+
+	s.RegisterHandler(method, path, handler)
+
+	return func(statusCode int, payload []byte) {
+		g.release(Response{StatusCode: statusCode, Body: payload})
+	}
+}
+
+func (g *gate) wait() chan Response {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	wait := make(chan Response, 1)
+	if len(g.released) > 0 {
+		wait <- g.released[0]
+		g.released = g.released[1:]
+		return wait
+	}
+
+	g.waiting = append(g.waiting, wait)
+	return wait
+}
+
+func (g *gate) release(resp Response) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if len(g.waiting) == 0 {
+		g.released = append(g.released, resp)
+		return
+	}
+
+	g.waiting[0] <- resp
+	g.waiting = g.waiting[1:]
+}
+
+// abandon stops wait from being released, handing its response on if it
+// was released in the meantime.
+func (g *gate) abandon(wait chan Response) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for i, waiting := range g.waiting {
+		if waiting == wait {
+			g.waiting = append(g.waiting[:i:i], g.waiting[i+1:]...)
+			return
+		}
+	}
+
+	select {
+	case resp := <-wait:
+		g.released = append([]Response{resp}, g.released...)
+	default:
+	}
+}
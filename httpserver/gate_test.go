@@ -0,0 +1,59 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestRegisterGated(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	release := server.RegisterGated("POST", "/jobs")
+
+	responses := make(chan *http.Response, 2)
+	send := func(count int) {
+		go func() {
+			resp, err := http.Post(server.Addr()+"/jobs", "text/plain", nil)
+			if err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+			responses <- resp
+		}()
+
+		for server.RequestCount() < count {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	send(1)
+	send(2)
+
+	select {
+	case <-responses:
+		t.Fatal("Expected the request to be held until released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if inFlight := server.InFlight(); len(inFlight) != 2 {
+		t.Fatalf("Expected %d pending requests, got %v", 2, inFlight)
+	}
+
+	release(http.StatusCreated, []byte("first"))
+	compareResponse(t, <-responses, http.StatusCreated, []byte("first"))
+
+	release(http.StatusAccepted, []byte("second"))
+	compareResponse(t, <-responses, http.StatusAccepted, []byte("second"))
+
+	t.Run("ReleasedAhead", func(t *testing.T) {
+		release(http.StatusOK, []byte("ready"))
+
+		resp := makeRequest(t, server, "POST", "/jobs")
+		compareResponse(t, resp, http.StatusOK, []byte("ready"))
+	})
+}
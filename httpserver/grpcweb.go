@@ -0,0 +1,41 @@
+package httpserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	grpcWebDataFrame    byte = 0x00
+	grpcWebTrailerFrame byte = 0x80
+)
+
+// RegisterGRPCWeb serves POST requests on path as a grpc-web unary call
+// responding with message, followed by a trailer frame carrying statusCode,
+// with the application/grpc-web content type.
+func (s *Server) RegisterGRPCWeb(path string, message []byte, statusCode codes.Code) {
+	trailer := []byte(fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", statusCode, statusCode))
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/grpc-web")
+		rw.WriteHeader(http.StatusOK)
+
+		if statusCode == codes.OK {
+			rw.Write(grpcWebFrame(grpcWebDataFrame, message))
+		}
+		rw.Write(grpcWebFrame(grpcWebTrailerFrame, trailer))
+	}
+
+	s.RegisterHandler("POST", path, handler)
+}
+
+func grpcWebFrame(flag byte, payload []byte) []byte {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	return frame
+}
@@ -0,0 +1,87 @@
+package httpserver_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+type grpcWebFrame struct {
+	Flag    byte
+	Payload []byte
+}
+
+func readGRPCWebFrames(t *testing.T, body io.Reader) []grpcWebFrame {
+	t.Helper()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+
+	frames := []grpcWebFrame{}
+	for len(data) > 0 {
+		if len(data) < 5 {
+			t.Fatalf("Truncated frame header: %v", data)
+		}
+
+		length := binary.BigEndian.Uint32(data[1:5])
+		if uint32(len(data)-5) < length {
+			t.Fatalf("Truncated frame payload, expected %d bytes, got %d", length, len(data)-5)
+		}
+
+		frames = append(frames, grpcWebFrame{Flag: data[0], Payload: data[5 : 5+length]})
+		data = data[5+length:]
+	}
+
+	return frames
+}
+
+func TestRegisterGRPCWeb(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	t.Run("OK", func(t *testing.T) {
+		server.RegisterGRPCWeb("/pkg.Service/Method", []byte("message"), codes.OK)
+
+		resp := makeRequest(t, server, "POST", "/pkg.Service/Method")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status code to be %d but it was %d", http.StatusOK, resp.StatusCode)
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/grpc-web" {
+			t.Fatalf("Expected content type to be application/grpc-web, it was %s", contentType)
+		}
+
+		frames := readGRPCWebFrames(t, resp.Body)
+		if len(frames) != 2 {
+			t.Fatalf("Expected %d frames, got %d", 2, len(frames))
+		}
+		if frames[0].Flag != 0x00 || !bytes.Equal(frames[0].Payload, []byte("message")) {
+			t.Fatalf("Expected data frame with message, got flag %x: %s", frames[0].Flag, frames[0].Payload)
+		}
+		if frames[1].Flag != 0x80 || !bytes.Contains(frames[1].Payload, []byte("grpc-status: 0\r\n")) {
+			t.Fatalf("Expected trailer frame with grpc-status 0, got flag %x: %s", frames[1].Flag, frames[1].Payload)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		server.RegisterGRPCWeb("/pkg.Service/Fail", []byte("message"), codes.NotFound)
+
+		resp := makeRequest(t, server, "POST", "/pkg.Service/Fail")
+		frames := readGRPCWebFrames(t, resp.Body)
+		if len(frames) != 1 {
+			t.Fatalf("Expected %d frames, got %d", 1, len(frames))
+		}
+		if frames[0].Flag != 0x80 || !bytes.Contains(frames[0].Payload, []byte("grpc-status: 5\r\n")) {
+			t.Fatalf("Expected trailer frame with grpc-status 5, got flag %x: %s", frames[0].Flag, frames[0].Payload)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// harLog is the root of a HAR 1.2 document, as written by ExportHAR.
+type harLog struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ExportHAR writes the recorded requests that have been responded to, along
+// with their responses, as a HAR 1.2 document.
+func (s *Server) ExportHAR(w io.Writer) error {
+	har := harLog{}
+	har.Log.Version = "1.2"
+	har.Log.Creator = harCreator{Name: "gofakes/httpserver", Version: "1.0"}
+	har.Log.Entries = []harEntry{}
+
+	s.lock.RLock()
+	for _, request := range s.requests {
+		if request.response == nil {
+			continue
+		}
+
+		har.Log.Entries = append(har.Log.Entries, harEntryFor(request))
+	}
+	s.lock.RUnlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(har), "encoding HAR")
+}
+
+func harEntryFor(request *recordedRequest) harEntry {
+	r := request.request
+	resp := request.response
+
+	scheme := "http"
+	if request.tls != nil {
+		scheme = "https"
+	}
+
+	cookies := []harNameValue{}
+	for _, cookie := range r.Cookies() {
+		cookies = append(cookies, harNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	query := []harNameValue{}
+	values := r.URL.Query()
+	for _, name := range sortedKeys(values) {
+		for _, value := range values[name] {
+			query = append(query, harNameValue{Name: name, Value: value})
+		}
+	}
+
+	harReq := harRequest{
+		Method:      r.Method,
+		URL:         scheme + "://" + r.Host + r.URL.RequestURI(),
+		HTTPVersion: r.Proto,
+		Cookies:     cookies,
+		Headers:     harHeaders(request.header),
+		QueryString: query,
+		HeadersSize: -1,
+		BodySize:    len(request.body),
+	}
+	if len(request.body) > 0 {
+		harReq.PostData = &harPostData{
+			MimeType: request.header.Get("Content-Type"),
+			Text:     string(request.body),
+		}
+	}
+
+	statusCode := resp.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	milliseconds := float64(request.duration) / float64(time.Millisecond)
+
+	return harEntry{
+		StartedDateTime: request.started.Format(time.RFC3339Nano),
+		Time:            milliseconds,
+		Request:         harReq,
+		Response: harResponse{
+			Status:      statusCode,
+			StatusText:  http.StatusText(statusCode),
+			HTTPVersion: r.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(resp.Header),
+			Content: harContent{
+				Size:     len(resp.Body),
+				MimeType: resp.Header.Get("Content-Type"),
+				Text:     string(resp.Body),
+			},
+			HeadersSize: -1,
+			BodySize:    len(resp.Body),
+		},
+		Timings: harTimings{Wait: milliseconds},
+	}
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+
+	return headers
+}
+
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
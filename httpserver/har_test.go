@@ -0,0 +1,99 @@
+package httpserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestExportHAR(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("POST", "/orders", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte("created"))
+	})
+
+	makeRequestWithBody(t, server, "POST", "/orders", []byte("new order"))
+	makeRequest(t, server, "GET", "/missing?page=2")
+
+	output := bytes.Buffer{}
+	if err := server.ExportHAR(&output); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+
+	har := struct {
+		Log struct {
+			Version string
+			Creator struct{ Name string }
+			Entries []struct {
+				StartedDateTime string
+				Request         struct {
+					Method      string
+					URL         string
+					QueryString []struct{ Name, Value string }
+					PostData    *struct{ Text string }
+				}
+				Response struct {
+					Status  int
+					Content struct {
+						MimeType string
+						Text     string
+					}
+				}
+			}
+		}
+	}{}
+	if err := json.Unmarshal(output.Bytes(), &har); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+
+	if har.Log.Version != "1.2" {
+		t.Fatalf("Expected HAR version to be %s, it was %s", "1.2", har.Log.Version)
+	}
+	if har.Log.Creator.Name == "" {
+		t.Fatalf("Expected HAR creator name to be set")
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected %d entries, got %d", 2, len(har.Log.Entries))
+	}
+
+	post := har.Log.Entries[0]
+	if post.Request.Method != "POST" {
+		t.Fatalf("Expected method to be %s, it was %s", "POST", post.Request.Method)
+	}
+	if !strings.HasPrefix(post.Request.URL, server.Addr()) || !strings.HasSuffix(post.Request.URL, "/orders") {
+		t.Fatalf("Expected URL to be %s/orders, it was %s", server.Addr(), post.Request.URL)
+	}
+	if post.Request.PostData == nil || post.Request.PostData.Text != "new order" {
+		t.Fatalf("Expected post data to be %s, it was %v", "new order", post.Request.PostData)
+	}
+	if post.Response.Status != http.StatusCreated {
+		t.Fatalf("Expected status to be %d, it was %d", http.StatusCreated, post.Response.Status)
+	}
+	if post.Response.Content.Text != "created" || post.Response.Content.MimeType != "text/plain" {
+		t.Fatalf("Expected content to be text/plain %s, it was %s %s", "created", post.Response.Content.MimeType, post.Response.Content.Text)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, post.StartedDateTime); err != nil {
+		t.Fatalf("Expected startedDateTime to be ISO 8601, got %s: %s", post.StartedDateTime, err)
+	}
+
+	get := har.Log.Entries[1]
+	if get.Response.Status != http.StatusNotFound {
+		t.Fatalf("Expected status to be %d, it was %d", http.StatusNotFound, get.Response.Status)
+	}
+	if len(get.Request.QueryString) != 1 || get.Request.QueryString[0].Name != "page" || get.Request.QueryString[0].Value != "2" {
+		t.Fatalf("Expected query string to be page=2, it was %v", get.Request.QueryString)
+	}
+	if get.Request.PostData != nil {
+		t.Fatalf("Expected no post data, got %v", get.Request.PostData)
+	}
+}
@@ -0,0 +1,195 @@
+package httpserver
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// readyListener closes ready the first time Accept is called, signaling that
+// the serve loop is running.
+type readyListener struct {
+	net.Listener
+	ready chan struct{}
+	once  sync.Once
+}
+
+func newReadyListener(listener net.Listener, ready chan struct{}) *readyListener {
+	return &readyListener{Listener: listener, ready: ready}
+}
+
+func (l *readyListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.ready) })
+	return l.Listener.Accept()
+}
+
+// delayListener waits for the delay reported by delay before handing each
+// accepted connection to the serve loop, holding back the ones queued behind
+// it. It gives up waiting once stopped is closed.
+type delayListener struct {
+	net.Listener
+	delay   func() time.Duration
+	stopped chan struct{}
+}
+
+func newDelayListener(listener net.Listener, delay func() time.Duration, stopped chan struct{}) *delayListener {
+	return &delayListener{Listener: listener, delay: delay, stopped: stopped}
+}
+
+func (l *delayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	d := l.delay()
+	if d <= 0 {
+		return conn, nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return conn, nil
+	case <-l.stopped:
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+}
+
+// limitListener serves at most limit connections at once. Accept waits for
+// one of them to be closed before taking the next one, which stays queued in
+// the kernel backlog meanwhile. A limit of 0 or less is no limit.
+type limitListener struct {
+	net.Listener
+	lock    sync.Mutex
+	freed   *sync.Cond
+	active  int
+	limit   int
+	stopped chan struct{}
+}
+
+func newLimitListener(listener net.Listener, limit int, stopped chan struct{}) *limitListener {
+	l := &limitListener{Listener: listener, limit: limit, stopped: stopped}
+	l.freed = sync.NewCond(&l.lock)
+
+	go func() {
+		<-stopped
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		l.freed.Broadcast()
+	}()
+
+	return l
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.acquire() {
+		return nil, net.ErrClosed
+	}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+
+	return &limitedConn{Conn: conn, release: l.release}, nil
+}
+
+func (l *limitListener) setLimit(limit int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.limit = limit
+	l.freed.Broadcast()
+}
+
+// acquire waits for a free slot, returning false if the server is stopped
+// first.
+func (l *limitListener) acquire() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for l.limit > 0 && l.active >= l.limit {
+		select {
+		case <-l.stopped:
+			return false
+		default:
+		}
+
+		l.freed.Wait()
+	}
+
+	l.active++
+	return true
+}
+
+func (l *limitListener) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.active--
+	l.freed.Broadcast()
+}
+
+// limitedConn frees its slot in the limitListener the first time it is
+// closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// connListener hands out a single, already established connection, then
+// blocks until it is closed.
+type connListener struct {
+	conn     net.Conn
+	accepted chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	accepted := make(chan struct{}, 1)
+	accepted <- struct{}{}
+	return &connListener{conn: conn, accepted: accepted, done: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.accepted:
+		return l.conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// bufferedConn reads what was already buffered from a hijacked connection
+// before reading from the connection itself.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,129 @@
+package httpserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestStartIsReady(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		server := httpserver.New()
+		if err := server.Start(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		server.RegisterPayload("GET", "/ready", http.StatusOK, []byte("ready"))
+
+		resp := makeRequest(t, server, "GET", "/ready")
+		compareResponse(t, resp, http.StatusOK, []byte("ready"))
+
+		if err := server.Stop(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestStartOn(t *testing.T) {
+	server := httpserver.New()
+	if err := server.StartOn("127.0.0.1:0"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer server.Stop()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+	if !strings.HasPrefix(server.Addr(), "http://127.0.0.1:") || strings.HasSuffix(server.Addr(), ":0") {
+		t.Fatalf("Expected address to be bound on 127.0.0.1 with a real port, it was %s", server.Addr())
+	}
+
+	resp := makeRequest(t, server, "GET", "/hello")
+	compareResponse(t, resp, http.StatusOK, []byte("hello"))
+
+	t.Run("InvalidAddress", func(t *testing.T) {
+		if err := httpserver.New().StartOn("not an address"); err == nil {
+			t.Fatal("Expected an error for an invalid address")
+		}
+	})
+}
+
+func TestSetAcceptDelay(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+	client := &http.Client{
+		Timeout:   100 * time.Millisecond,
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+
+	resp, err := client.Get(server.Addr() + "/hello")
+	if err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("hello"))
+
+	server.SetAcceptDelay(time.Second)
+
+	start := time.Now()
+	if _, err := client.Get(server.Addr() + "/hello"); err == nil {
+		t.Fatal("Expected the request to time out while the connection waits to be accepted")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("Expected the client to give up before the accept delay, it took %s", elapsed)
+	}
+}
+
+func TestSetMaxConnections(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+	server.SetMaxConnections(1)
+
+	conn := dialServer(t, server)
+	fmt.Fprint(conn, "GET /hello HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("hello"))
+
+	responses := make(chan *http.Response)
+	go func() {
+		client := http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get(server.Addr() + "/hello")
+		if err != nil {
+			t.Errorf("err: %s", err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+
+	select {
+	case <-responses:
+		t.Fatal("Expected the second connection to wait for the first one to close")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conn.Close()
+
+	select {
+	case resp, ok := <-responses:
+		if !ok {
+			t.FailNow()
+		}
+		compareResponse(t, resp, http.StatusOK, []byte("hello"))
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second connection to be served once the first one closed")
+	}
+
+	if server.ConnectionCount() != 2 {
+		t.Fatalf("Expected connection count to be %d, it was %d", 2, server.ConnectionCount())
+	}
+}
@@ -0,0 +1,40 @@
+package httpserver
+
+// Metrics is a consistent snapshot of the traffic recorded since the last
+// Reset.
+type Metrics struct {
+	RequestCount int
+	// RouteCounts counts requests per method and matched route, e.g.
+	// "GET /users/{id}". Unmatched requests are not included.
+	RouteCounts map[string]int
+	// BytesIn is the total size of the request bodies.
+	BytesIn int64
+	// BytesOut is the total size of the response bodies written so far.
+	BytesOut int64
+	// MaxConcurrency is the highest number of handlers running at once.
+	MaxConcurrency int
+}
+
+// Metrics returns a snapshot of the recorded traffic, taken under a single
+// lock so the values are consistent with each other.
+func (s *Server) Metrics() Metrics {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	metrics := Metrics{
+		RequestCount:   len(s.requests),
+		RouteCounts:    map[string]int{},
+		MaxConcurrency: s.maxConcurrency,
+	}
+
+	for _, request := range s.requests {
+		metrics.BytesIn += int64(len(request.body))
+		metrics.BytesOut += request.bytesOut
+
+		if request.matched {
+			metrics.RouteCounts[request.request.Method+" "+request.route]++
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,63 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestMetrics(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	release := make(chan struct{})
+	server.RegisterHandler("GET", "/items/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		<-release
+		rw.Write([]byte("item"))
+	})
+	server.RegisterPayload("POST", "/items", http.StatusCreated, []byte("created"))
+
+	wg := sync.WaitGroup{}
+	for _, path := range []string{"/items/1", "/items/2", "/items/3"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := http.Get(server.Addr() + path)
+			if err != nil {
+				t.Errorf("Unexpected err: %s", err)
+				return
+			}
+			resp.Body.Close()
+		}(path)
+	}
+
+	for server.RequestCount() < 3 {
+		<-time.After(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	makeRequestWithBody(t, server, "POST", "/items", []byte("new item"))
+	makeRequest(t, server, "GET", "/missing")
+
+	metrics := server.Metrics()
+	if metrics.RequestCount != 5 {
+		t.Fatalf("Expected request count to be %d, it was %d", 5, metrics.RequestCount)
+	}
+	if metrics.RouteCounts["GET /items/{id}"] != 3 || metrics.RouteCounts["POST /items"] != 1 || len(metrics.RouteCounts) != 2 {
+		t.Fatalf("Unexpected route counts: %v", metrics.RouteCounts)
+	}
+	if metrics.BytesIn != int64(len("new item")) {
+		t.Fatalf("Expected bytes in to be %d, it was %d", len("new item"), metrics.BytesIn)
+	}
+	if metrics.BytesOut != int64(3*len("item")+len("created")) {
+		t.Fatalf("Expected bytes out to be %d, it was %d", 3*len("item")+len("created"), metrics.BytesOut)
+	}
+	if metrics.MaxConcurrency != 3 {
+		t.Fatalf("Expected max concurrency to be %d, it was %d", 3, metrics.MaxConcurrency)
+	}
+}
@@ -0,0 +1,34 @@
+package httpserver
+
+import (
+	"net"
+	"time"
+)
+
+// Option configures a Server created with New.
+type Option func(*Server)
+
+// WithStrictRegistration rejects registering a handler for a method and path
+// that already have one, instead of replacing it.
+func WithStrictRegistration() Option {
+	return func(s *Server) {
+		s.strict = true
+	}
+}
+
+// WithStartRetries makes Start try to listen up to n more times when it
+// fails, waiting backoff before each attempt. By default it doesn't retry.
+func WithStartRetries(n int, backoff time.Duration) Option {
+	return func(s *Server) {
+		s.startRetries = n
+		s.startBackoff = backoff
+	}
+}
+
+// WithListenFunc makes the server create its listener with listen instead of
+// net.Listen.
+func WithListenFunc(listen func(network, address string) (net.Listener, error)) Option {
+	return func(s *Server) {
+		s.listen = listen
+	}
+}
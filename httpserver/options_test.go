@@ -0,0 +1,122 @@
+package httpserver_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestWithStrictRegistration(t *testing.T) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {}
+
+	t.Run("Default", func(t *testing.T) {
+		server := httpserver.New()
+		server.Start()
+		defer server.Stop()
+
+		server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("first"))
+		server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("second"))
+
+		resp := makeRequest(t, server, "GET", "/hello")
+		compareResponse(t, resp, http.StatusOK, []byte("second"))
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		server := httpserver.New(httpserver.WithStrictRegistration())
+
+		cases := []struct {
+			Name string
+			Path string
+		}{
+			{"Exact", "/hello"},
+			{"Pattern", "/users/{id}"},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.Name, func(t *testing.T) {
+				if err := server.TryRegisterHandler("GET", tc.Path, handler); err != nil {
+					t.Fatalf("Unexpected err: %s", err)
+				}
+				if err := server.TryRegisterHandler("POST", tc.Path, handler); err != nil {
+					t.Fatalf("Unexpected err: %s", err)
+				}
+				if err := server.TryRegisterHandler("get", tc.Path, handler); err == nil {
+					t.Fatalf("Expected duplicate registration of GET %s to fail", tc.Path)
+				}
+			})
+		}
+
+		t.Run("Panics", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Expected duplicate RegisterHandler to panic")
+				}
+			}()
+
+			server.RegisterHandler("GET", "/hello", handler)
+		})
+
+		t.Run("AfterReset", func(t *testing.T) {
+			server.Reset()
+
+			if err := server.TryRegisterHandler("GET", "/hello", handler); err != nil {
+				t.Fatalf("Unexpected err: %s", err)
+			}
+		})
+	})
+}
+
+func TestWithStartRetries(t *testing.T) {
+	flakyListen := func(failures int) (func(network, address string) (net.Listener, error), *int) {
+		attempts := 0
+		return func(network, address string) (net.Listener, error) {
+			attempts++
+			if attempts <= failures {
+				return nil, errors.New("address already in use")
+			}
+			return net.Listen(network, address)
+		}, &attempts
+	}
+
+	t.Run("Retries", func(t *testing.T) {
+		listen, attempts := flakyListen(1)
+		server := httpserver.New(httpserver.WithListenFunc(listen), httpserver.WithStartRetries(2, time.Millisecond))
+		if err := server.Start(); err != nil {
+			t.Fatalf("Unexpected err: %s", err)
+		}
+		defer server.Stop()
+		server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+		resp := makeRequest(t, server, "GET", "/hello")
+		compareResponse(t, resp, http.StatusOK, []byte("hello"))
+		if *attempts != 2 {
+			t.Fatalf("Expected %d listen attempts, got %d", 2, *attempts)
+		}
+	})
+
+	t.Run("RetriesRunOut", func(t *testing.T) {
+		listen, attempts := flakyListen(3)
+		server := httpserver.New(httpserver.WithListenFunc(listen), httpserver.WithStartRetries(2, time.Millisecond))
+		if err := server.Start(); err == nil {
+			t.Fatal("Expected Start to fail once the retries ran out")
+		}
+		if *attempts != 3 {
+			t.Fatalf("Expected %d listen attempts, got %d", 3, *attempts)
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		listen, attempts := flakyListen(1)
+		server := httpserver.New(httpserver.WithListenFunc(listen))
+		if err := server.Start(); err == nil {
+			t.Fatal("Expected Start to fail without retries")
+		}
+		if *attempts != 1 {
+			t.Fatalf("Expected %d listen attempt, got %d", 1, *attempts)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package httpserver
+
+import "net/http"
+
+// Pause holds new and recorded requests before their handlers run until
+// Resume is called. Requests are still recorded as they arrive, and a client
+// giving up releases its own request. Reset also resumes the server.
+func (s *Server) Pause() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.paused == nil {
+		s.paused = make(chan struct{})
+	}
+}
+
+// Resume releases the requests held since Pause.
+func (s *Server) Resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.resume()
+}
+
+func (s *Server) resume() {
+	if s.paused != nil {
+		close(s.paused)
+		s.paused = nil
+	}
+}
+
+// waitWhilePaused blocks while the server is paused, returning false if the
+// request was cancelled in the meantime.
+func (s *Server) waitWhilePaused(r *http.Request) bool {
+	s.lock.RLock()
+	paused := s.paused
+	s.lock.RUnlock()
+
+	if paused == nil {
+		return true
+	}
+
+	select {
+	case <-paused:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,120 @@
+package httpserver_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestPause(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+	server.Pause()
+
+	done := make(chan *http.Response)
+	go func() {
+		resp, err := http.Get(server.Addr() + "/hello")
+		if err != nil {
+			t.Errorf("Unexpected err: %s", err)
+		}
+		done <- resp
+	}()
+
+	if _, ok := server.WaitForRequest("GET", "/hello", time.Second); !ok {
+		t.Fatal("Expected request to be recorded while paused")
+	}
+
+	select {
+	case <-done:
+		t.Fatal("Expected request to block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.Resume()
+
+	select {
+	case resp := <-done:
+		compareResponse(t, resp, http.StatusOK, []byte("hello"))
+	case <-time.After(time.Second):
+		t.Fatal("Expected request to complete after Resume")
+	}
+
+	t.Run("ClientCancellation", func(t *testing.T) {
+		server.Pause()
+		defer server.Resume()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequest("GET", server.Addr()+"/hello", nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if _, err := http.DefaultClient.Do(req.WithContext(ctx)); err == nil {
+			t.Fatal("Expected paused request to time out")
+		}
+	})
+}
+
+func TestInFlight(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	release := make(chan struct{})
+	server.RegisterHandler("GET", "/blocked", func(rw http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	server.RegisterPayload("POST", "/paused", http.StatusOK, []byte{})
+
+	if inFlight := server.InFlight(); len(inFlight) != 0 {
+		t.Fatalf("Expected nothing in flight, got %v", inFlight)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer func() { done <- struct{}{} }()
+		resp, err := http.Get(server.Addr() + "/blocked")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	if _, ok := server.WaitForRequest("GET", "/blocked", time.Second); !ok {
+		t.Fatal("Expected blocked request to arrive")
+	}
+
+	server.Pause()
+	go func() {
+		defer func() { done <- struct{}{} }()
+		resp, err := http.Post(server.Addr()+"/paused", "text/plain", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	if _, ok := server.WaitForRequest("POST", "/paused", time.Second); !ok {
+		t.Fatal("Expected paused request to arrive")
+	}
+
+	inFlight := server.InFlight()
+	if len(inFlight) != 2 || inFlight[0] != "GET /blocked" || inFlight[1] != "POST /paused" {
+		t.Fatalf("Expected both requests to be in flight, got %v", inFlight)
+	}
+
+	close(release)
+	server.Resume()
+	<-done
+	<-done
+
+	for start := time.Now(); len(server.InFlight()) != 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Expected nothing in flight after completion, got %v", server.InFlight())
+		}
+	}
+}
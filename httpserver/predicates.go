@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Predicate reports whether a request, along with its captured body, is of
+// interest. Predicates are built with MatchMethod, MatchPath, MatchHeader and
+// And, and used with FindRequests, or with RegisterMatcher through Matcher.
+type Predicate func(r *http.Request, body []byte) bool
+
+// Matcher adapts p for RegisterMatcher. Matchers run before the body is read,
+// so p is always given a nil body.
+func (p Predicate) Matcher() func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		return p(r, nil)
+	}
+}
+
+// MatchMethod matches requests with method, ignoring case.
+func MatchMethod(method string) Predicate {
+	return func(r *http.Request, body []byte) bool {
+		return strings.EqualFold(r.Method, method)
+	}
+}
+
+// MatchPath matches requests for path exactly.
+func MatchPath(path string) Predicate {
+	return func(r *http.Request, body []byte) bool {
+		return r.URL.Path == path
+	}
+}
+
+// MatchHeader matches requests whose first name header has value.
+func MatchHeader(name, value string) Predicate {
+	return func(r *http.Request, body []byte) bool {
+		return r.Header.Get(name) == value
+	}
+}
+
+// And matches requests that all of predicates match. With no predicates it
+// matches everything.
+func And(predicates ...Predicate) Predicate {
+	return func(r *http.Request, body []byte) bool {
+		for _, predicate := range predicates {
+			if !predicate(r, body) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FindRequests returns the received requests that match, in the order they
+// were recorded. match sees the headers as they arrived, is called with the
+// server lock held and must not call back into the server.
+func (s *Server) FindRequests(match Predicate) []CapturedRequest {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	found := []CapturedRequest{}
+	for _, request := range s.requests {
+		if !request.received {
+			continue
+		}
+
+		r := *request.request
+		r.Header = request.header
+		if match(&r, request.body) {
+			found = append(found, request.captured())
+		}
+	}
+
+	return found
+}
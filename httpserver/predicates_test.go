@@ -0,0 +1,126 @@
+package httpserver_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestPredicates(t *testing.T) {
+	get, _ := http.NewRequest("GET", "http://example.com/users", nil)
+	get.Header.Set("X-Tenant", "acme")
+	post, _ := http.NewRequest("POST", "http://example.com/users", nil)
+
+	cases := []struct {
+		Name      string
+		Predicate httpserver.Predicate
+		Request   *http.Request
+		Expected  bool
+	}{
+		{"MethodIgnoresCase", httpserver.MatchMethod("get"), get, true},
+		{"MethodMismatch", httpserver.MatchMethod("GET"), post, false},
+		{"Path", httpserver.MatchPath("/users"), post, true},
+		{"PathMismatch", httpserver.MatchPath("/users/1"), get, false},
+		{"Header", httpserver.MatchHeader("x-tenant", "acme"), get, true},
+		{"HeaderMissing", httpserver.MatchHeader("X-Tenant", "acme"), post, false},
+		{"And", httpserver.And(httpserver.MatchMethod("GET"), httpserver.MatchPath("/users"), httpserver.MatchHeader("X-Tenant", "acme")), get, true},
+		{"AndOneFails", httpserver.And(httpserver.MatchMethod("POST"), httpserver.MatchHeader("X-Tenant", "acme")), post, false},
+		{"AndEmpty", httpserver.And(), post, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if matched := tc.Predicate(tc.Request, nil); matched != tc.Expected {
+				t.Fatalf("Expected predicate to return %t, it returned %t", tc.Expected, matched)
+			}
+		})
+	}
+}
+
+func TestFindRequests(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	header := http.Header{}
+	header.Set("X-Tenant", "acme")
+	makeRequestWithHeaders(t, server, "POST", "/orders", header)
+	makeRequestWithBody(t, server, "POST", "/orders", []byte("no tenant"))
+	makeRequestWithHeaders(t, server, "GET", "/orders", header)
+
+	found := server.FindRequests(httpserver.And(httpserver.MatchMethod("POST"), httpserver.MatchPath("/orders")))
+	if len(found) != 2 {
+		t.Fatalf("Expected %d requests, found %d", 2, len(found))
+	}
+	if !bytes.Equal(found[1].Body, []byte("no tenant")) {
+		t.Fatalf("Expected body to be %s, it was %s", "no tenant", found[1].Body)
+	}
+
+	withBody := func(r *http.Request, body []byte) bool {
+		return bytes.Contains(body, []byte("tenant"))
+	}
+	found = server.FindRequests(httpserver.And(httpserver.MatchHeader("X-Tenant", "acme"), withBody))
+	if len(found) != 0 {
+		t.Fatalf("Expected %d requests, found %d", 0, len(found))
+	}
+
+	found = server.FindRequests(httpserver.MatchHeader("X-Tenant", "acme"))
+	if len(found) != 2 {
+		t.Fatalf("Expected %d requests, found %d", 2, len(found))
+	}
+	compareRequest(t, found[1].Request, "GET", "/orders")
+}
+
+func TestFindRequestsSeesHeadersAsReceived(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("GET", "/orders", func(rw http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Tenant", "rewritten")
+	})
+
+	header := http.Header{}
+	header.Set("X-Tenant", "acme")
+	makeRequestWithHeaders(t, server, "GET", "/orders", header)
+
+	found := server.FindRequests(httpserver.MatchHeader("X-Tenant", "acme"))
+	if len(found) != 1 {
+		t.Fatalf("Expected %d requests, found %d", 1, len(found))
+	}
+}
+
+func TestPredicateMatcher(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	match := httpserver.And(httpserver.MatchMethod("POST"), httpserver.MatchHeader("X-Tenant", "acme"))
+	server.RegisterMatcher(match.Matcher(), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("acme"))
+	})
+
+	header := http.Header{}
+	header.Set("X-Tenant", "acme")
+
+	cases := []struct {
+		Name           string
+		Method         string
+		Header         http.Header
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"Matches", "POST", header, http.StatusOK, []byte("acme")},
+		{"WrongMethod", "GET", header, http.StatusNotFound, []byte{}},
+		{"NoHeader", "POST", http.Header{}, http.StatusNotFound, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequestWithHeaders(t, server, tc.Method, "/anything", tc.Header)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
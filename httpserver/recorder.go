@@ -0,0 +1,28 @@
+package httpserver
+
+// Recorder receives every exchange a Server handles once its handler has
+// returned. A single Recorder can be shared by several servers, which tell
+// themselves apart by the name set with SetName. Record may be called
+// concurrently.
+type Recorder interface {
+	Record(server string, request CapturedRequest, response *Response)
+}
+
+// SetName sets the name the server reports itself as to its Recorder. It
+// survives Reset.
+func (s *Server) SetName(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.name = name
+}
+
+// SetRecorder makes the server pass every exchange it handles to recorder, in
+// addition to recording it itself. A nil recorder stops it. It survives
+// Reset.
+func (s *Server) SetRecorder(recorder Recorder) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.recorder = recorder
+}
@@ -0,0 +1,69 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+type sink struct {
+	lock    sync.Mutex
+	records []string
+}
+
+func (s *sink) Record(server string, request httpserver.CapturedRequest, response *httpserver.Response) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.records = append(s.records, server+" "+request.Request.Method+" "+request.Request.URL.Path+" "+string(request.Body)+" "+string(response.Body))
+}
+
+func TestSharedRecorder(t *testing.T) {
+	shared := &sink{}
+
+	users := httpserver.New()
+	users.Start()
+	defer users.Stop()
+	users.SetName("users")
+	users.SetRecorder(shared)
+	users.RegisterPayload("GET", "/users/1", http.StatusOK, []byte("ann"))
+
+	billing := httpserver.New()
+	billing.Start()
+	defer billing.Stop()
+	billing.SetName("billing")
+	billing.SetRecorder(shared)
+	billing.RegisterPayload("POST", "/charges", http.StatusCreated, []byte("charged"))
+
+	makeRequest(t, users, "GET", "/users/1")
+	makeRequestWithBody(t, billing, "POST", "/charges", []byte("10 EUR"))
+
+	billing.Reset()
+	makeRequest(t, billing, "GET", "/missing")
+
+	expected := []string{
+		"users GET /users/1  ann",
+		"billing POST /charges 10 EUR charged",
+		"billing GET /missing  ",
+	}
+
+	if len(shared.records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d: %v", len(expected), len(shared.records), shared.records)
+	}
+	for i, record := range expected {
+		if shared.records[i] != record {
+			t.Fatalf("Expected record %d to be %q, it was %q", i, record, shared.records[i])
+		}
+	}
+
+	t.Run("Detached", func(t *testing.T) {
+		users.SetRecorder(nil)
+		makeRequest(t, users, "GET", "/users/1")
+
+		if len(shared.records) != len(expected) {
+			t.Fatalf("Expected %d records, got %d", len(expected), len(shared.records))
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// exchange is a request and the response it got, as written by DumpRequests.
+type exchange struct {
+	Method   string
+	Path     string
+	Query    string
+	Body     []byte
+	Session  string `json:",omitempty"`
+	Response Response
+}
+
+// SessionKey extracts the session a request belongs to, or an empty string if
+// it has none.
+type SessionKey func(r *http.Request) string
+
+// SessionCookie is a SessionKey that identifies sessions by the value of the
+// name cookie.
+func SessionCookie(name string) SessionKey {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// SetSessionKey partitions recordings by session: DumpRequests stores the
+// session of each request as found by key, and LoadRecording replays the
+// recorded responses to each session separately. It survives Reset.
+func (s *Server) SetSessionKey(key SessionKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sessionKey = key
+}
+
+// DumpRequests writes the recorded requests that have been responded to,
+// along with their responses, as JSON. The output can be loaded into another
+// server with LoadRecording.
+func (s *Server) DumpRequests(w io.Writer) error {
+	s.lock.RLock()
+	exchanges := []exchange{}
+	for _, request := range s.requests {
+		if request.response == nil {
+			continue
+		}
+
+		exchanges = append(exchanges, exchange{
+			Method:   request.request.Method,
+			Path:     request.request.URL.Path,
+			Query:    request.request.URL.RawQuery,
+			Body:     request.body,
+			Session:  s.sessionOf(request),
+			Response: *request.response,
+		})
+	}
+	s.lock.RUnlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(exchanges), "encoding recording")
+}
+
+// sessionOf returns the session of request as found by the SessionKey, or an
+// empty string if none is set. It must be called with the lock held.
+func (s *Server) sessionOf(request *recordedRequest) string {
+	if s.sessionKey == nil {
+		return ""
+	}
+
+	r := *request.request
+	r.Header = request.header
+	return s.sessionKey(&r)
+}
+
+// LoadRecording reads a recording written by DumpRequests and replays it:
+// each recorded method and path is registered to respond to requests with
+// the same query and body with the recorded responses, in order. Once they
+// run out the last one is repeated. Requests that were not recorded get a
+// 404. When a SessionKey is set, requests only get the responses recorded
+// for their own session. Nothing is registered if any of the routes can't be,
+// such as when the server was created WithStrictRegistration and one of them
+// is already registered.
+func (s *Server) LoadRecording(r io.Reader) error {
+	exchanges := []exchange{}
+	if err := json.NewDecoder(r).Decode(&exchanges); err != nil {
+		return errors.Wrap(err, "decoding recording")
+	}
+
+	s.lock.RLock()
+	sessionKey := s.sessionKey
+	s.lock.RUnlock()
+
+	replays := map[routeKey]*replay{}
+	order := []routeKey{}
+	for _, exchange := range exchanges {
+		key := routeKey{method: strings.ToUpper(exchange.Method), path: exchange.Path}
+		if _, ok := replays[key]; !ok {
+			replays[key] = &replay{responses: map[string][]Response{}, sessionKey: sessionKey}
+			order = append(order, key)
+		}
+
+		signature := replaySignature(exchange.Session, exchange.Query, exchange.Body)
+		replays[key].responses[signature] = append(replays[key].responses[signature], exchange.Response)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, key := range order {
+		if strings.Contains(key.path, "?") {
+			return errors.Errorf("recorded path %s contains a query", key.path)
+		}
+		if s.strict && s.registered(key.method, key.path) {
+			return errors.Errorf("route %s %s is already registered", key.method, key.path)
+		}
+	}
+
+	for _, key := range order {
+		s.register(key.method, key.path, replays[key].ServeHTTP)
+	}
+
+	return nil
+}
+
+type replay struct {
+	responses  map[string][]Response
+	served     map[string]int
+	sessionKey SessionKey
+	lock       sync.Mutex
+}
+
+func (p *replay) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	session := ""
+	if p.sessionKey != nil {
+		session = p.sessionKey(r)
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	signature := replaySignature(session, r.URL.RawQuery, body)
+
+	resp, ok := p.next(signature)
+	if !ok {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp.ServeHTTP(rw, r)
+}
+
+func (p *replay) next(signature string) (Response, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	responses := p.responses[signature]
+	if len(responses) == 0 {
+		return Response{}, false
+	}
+
+	if p.served == nil {
+		p.served = map[string]int{}
+	}
+
+	index := p.served[signature]
+	if index >= len(responses) {
+		index = len(responses) - 1
+	}
+	p.served[signature]++
+
+	return responses[index], true
+}
+
+func replaySignature(session, query string, body []byte) string {
+	return session + "\n" + query + "\n" + string(body)
+}
@@ -0,0 +1,148 @@
+package httpserver_test
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestDumpAndLoadRecording(t *testing.T) {
+	backend := httpserver.New()
+	backend.Start()
+	defer backend.Stop()
+
+	calls := 0
+	backend.RegisterHandler("POST", "/orders", func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+		rw.Header().Set("X-Call", strconv.Itoa(calls))
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte("order " + strconv.Itoa(calls)))
+	})
+	backend.RegisterPayload("GET", "/orders", http.StatusOK, []byte("all orders"))
+
+	makeRequestWithBody(t, backend, "POST", "/orders", []byte("first"))
+	makeRequestWithBody(t, backend, "POST", "/orders", []byte("first"))
+	makeRequestWithBody(t, backend, "POST", "/orders", []byte("second"))
+	makeRequest(t, backend, "GET", "/orders?page=1")
+
+	recording := bytes.Buffer{}
+	if err := backend.DumpRequests(&recording); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+	dumped := append([]byte{}, recording.Bytes()...)
+
+	replay := httpserver.New()
+	replay.Start()
+	defer replay.Stop()
+
+	if err := replay.LoadRecording(&recording); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+
+	resp := makeRequestWithBody(t, replay, "POST", "/orders", []byte("second"))
+	compareResponse(t, resp, http.StatusCreated, []byte("order 3"))
+	if resp.Header.Get("X-Call") != "3" {
+		t.Fatalf("Expected X-Call header to be %s, it was %s", "3", resp.Header.Get("X-Call"))
+	}
+
+	resp = makeRequestWithBody(t, replay, "POST", "/orders", []byte("first"))
+	compareResponse(t, resp, http.StatusCreated, []byte("order 1"))
+
+	resp = makeRequestWithBody(t, replay, "POST", "/orders", []byte("first"))
+	compareResponse(t, resp, http.StatusCreated, []byte("order 2"))
+
+	resp = makeRequestWithBody(t, replay, "POST", "/orders", []byte("first"))
+	compareResponse(t, resp, http.StatusCreated, []byte("order 2"))
+
+	resp = makeRequest(t, replay, "GET", "/orders?page=1")
+	compareResponse(t, resp, http.StatusOK, []byte("all orders"))
+
+	resp = makeRequest(t, replay, "GET", "/orders?page=2")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+
+	t.Run("InvalidRecording", func(t *testing.T) {
+		if err := replay.LoadRecording(bytes.NewBufferString("not json")); err == nil {
+			t.Fatal("Expected an error loading an invalid recording")
+		}
+	})
+
+	t.Run("StrictRegistration", func(t *testing.T) {
+		strict := httpserver.New(httpserver.WithStrictRegistration())
+		strict.Start()
+		defer strict.Stop()
+
+		strict.RegisterPayload("GET", "/orders", http.StatusOK, []byte("live orders"))
+
+		if err := strict.LoadRecording(bytes.NewReader(dumped)); err == nil {
+			t.Fatal("Expected an error loading a recording over a registered route")
+		}
+
+		resp := makeRequestWithBody(t, strict, "POST", "/orders", []byte("first"))
+		compareResponse(t, resp, http.StatusMethodNotAllowed, []byte{})
+
+		resp = makeRequest(t, strict, "GET", "/orders")
+		compareResponse(t, resp, http.StatusOK, []byte("live orders"))
+	})
+}
+
+func TestLoadRecordingWithSessions(t *testing.T) {
+	request := func(t *testing.T, server *httpserver.Server, session string) *http.Response {
+		t.Helper()
+
+		header := http.Header{}
+		header.Set("Cookie", "session="+session)
+		return makeRequestWithHeaders(t, server, "GET", "/step", header)
+	}
+
+	backend := httpserver.New()
+	backend.SetSessionKey(httpserver.SessionCookie("session"))
+	backend.Start()
+	defer backend.Stop()
+
+	steps := map[string]int{}
+	backend.RegisterHandler("GET", "/step", func(rw http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("session")
+		steps[cookie.Value]++
+		rw.Write([]byte(cookie.Value + " step " + strconv.Itoa(steps[cookie.Value])))
+	})
+
+	request(t, backend, "alice")
+	request(t, backend, "bob")
+	request(t, backend, "alice")
+	request(t, backend, "bob")
+
+	recording := bytes.Buffer{}
+	if err := backend.DumpRequests(&recording); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+
+	replay := httpserver.New()
+	replay.SetSessionKey(httpserver.SessionCookie("session"))
+	replay.Start()
+	defer replay.Stop()
+
+	if err := replay.LoadRecording(&recording); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+
+	cases := []struct {
+		Session      string
+		ExpectedBody string
+	}{
+		{"bob", "bob step 1"},
+		{"bob", "bob step 2"},
+		{"alice", "alice step 1"},
+		{"alice", "alice step 2"},
+	}
+
+	for _, tc := range cases {
+		resp := request(t, replay, tc.Session)
+		compareResponse(t, resp, http.StatusOK, []byte(tc.ExpectedBody))
+	}
+
+	resp := request(t, replay, "mallory")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+}
@@ -0,0 +1,743 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Response describes a canned response served by one of the Register helpers.
+// A zero StatusCode is served as 200.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ServeHTTP writes the response, so a Response can be registered as a handler.
+func (resp Response) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	for name, values := range resp.Header {
+		for _, value := range values {
+			rw.Header().Add(name, value)
+		}
+	}
+
+	statusCode := resp.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	rw.WriteHeader(statusCode)
+	rw.Write(resp.Body)
+}
+
+// QueueResponseFor queues resp to be served, once, to the next request for
+// method and path. Queued responses are served in order before any handler
+// registered for the route, which takes over once the queue is empty.
+func (s *Server) QueueResponseFor(method, path string, resp Response) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := routeKey{method: strings.ToLower(method), path: path}
+	s.queues[key] = append(s.queues[key], resp)
+}
+
+func (s *Server) dequeue(key routeKey) (Response, bool) {
+	queue := s.queues[key]
+	if len(queue) == 0 {
+		return Response{}, false
+	}
+
+	s.queues[key] = queue[1:]
+	return queue[0], true
+}
+
+// RegisterTimedSwitch serves before until switchAfter has elapsed since
+// registration, and after from then on.
+func (s *Server) RegisterTimedSwitch(method, path string, before, after Response, switchAfter time.Duration) {
+	switchAt := s.now().Add(switchAfter)
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if s.now().Before(switchAt) {
+			before.ServeHTTP(rw, r)
+			return
+		}
+
+		after.ServeHTTP(rw, r)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterValidated runs validate against the request body, responding with
+// 400 and the validation error on failure, or okStatus and okBody otherwise.
+func (s *Server) RegisterValidated(method, path string, validate func([]byte) error, okStatus int, okBody []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = validate(body)
+		}
+
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		rw.WriteHeader(okStatus)
+		rw.Write(okBody)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterWithContentLength serves payload with a Content-Length header of
+// declaredLength, regardless of the actual payload size. The response is
+// written raw, as RegisterRaw does, so all of payload reaches the client even
+// when it is longer than declared.
+func (s *Server) RegisterWithContentLength(method, path string, declaredLength int, payload []byte) {
+	raw := bytes.Buffer{}
+	fmt.Fprintf(&raw, "HTTP/1.1 %d %s\r\n", http.StatusOK, http.StatusText(http.StatusOK))
+	fmt.Fprintf(&raw, "Content-Length: %d\r\nConnection: close\r\n\r\n", declaredLength)
+	raw.Write(payload)
+
+	s.RegisterRaw(method, path, raw.Bytes())
+}
+
+// RegisterIndexed serves responses[n] on the nth call to the route, counting
+// from 0, and defaultResp for calls without an entry.
+func (s *Server) RegisterIndexed(method, path string, responses map[int]Response, defaultResp Response) {
+	var calls int32 = -1
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		index := int(atomic.AddInt32(&calls, 1))
+
+		if resp, ok := responses[index]; ok {
+			resp.ServeHTTP(rw, r)
+			return
+		}
+
+		defaultResp.ServeHTTP(rw, r)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterRaw hijacks the connection and writes raw verbatim, status line and
+// headers included, closing the connection afterwards.
+func (s *Server) RegisterRaw(method, path string, raw []byte) {
+	s.RegisterHandler(method, path, rawHandler(raw))
+}
+
+// RegisterHTTP10 serves resp as an HTTP/1.0 response, with an explicit
+// Content-Length and the connection closed after it, as legacy servers do.
+func (s *Server) RegisterHTTP10(method, path string, resp Response) {
+	statusCode := resp.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	header := resp.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	header.Set("Connection", "close")
+
+	raw := bytes.Buffer{}
+	fmt.Fprintf(&raw, "HTTP/1.0 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	header.Write(&raw)
+	raw.WriteString("\r\n")
+	raw.Write(resp.Body)
+
+	s.RegisterRaw(method, path, raw.Bytes())
+}
+
+func rawHandler(raw []byte) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		hijacker, ok := rw.(http.Hijacker)
+		if !ok {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+
+		buf.Write(raw)
+		buf.Flush()
+	}
+}
+
+// RegisterWithConnectionClose serves payload with "Connection: close", and
+// the server closes the connection once the response is written.
+func (s *Server) RegisterWithConnectionClose(method, path string, statusCode int, payload []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Connection", "close")
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterForceKeepAlive serves payload with a Connection header of
+// keep-alive or close, as keepAlive says, whatever the request asked for.
+// With keepAlive false the server closes the connection after the response.
+// With keepAlive true it keeps it open: when the client asked to close it,
+// or keep-alives are disabled, the response is written on the hijacked
+// connection, which then goes on serving requests as the server would.
+func (s *Server) RegisterForceKeepAlive(method, path string, statusCode int, payload []byte, keepAlive bool) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if !keepAlive {
+			rw.Header().Set("Connection", "close")
+			rw.WriteHeader(statusCode)
+			rw.Write(payload)
+			return
+		}
+
+		s.lock.RLock()
+		keepAlives := s.keepAlives
+		s.lock.RUnlock()
+
+		if keepAlives && !r.Close {
+			rw.Header().Set("Connection", "keep-alive")
+			rw.WriteHeader(statusCode)
+			rw.Write(payload)
+			return
+		}
+
+		s.keepServing(rw, statusCode, payload, keepAlives)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// keepServing writes the response on the hijacked connection, announcing it
+// is kept alive, and hands the connection to a server of its own that goes
+// on routing its requests through s until either side closes it or s is
+// stopped.
+func (s *Server) keepServing(rw http.ResponseWriter, statusCode int, payload []byte, keepAlives bool) {
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	fmt.Fprintf(buf, "Connection: keep-alive\r\nContent-Length: %d\r\n\r\n", len(payload))
+	buf.Write(payload)
+	if buf.Flush() != nil {
+		conn.Close()
+		return
+	}
+
+	listener := newConnListener(&bufferedConn{Conn: conn, reader: buf.Reader})
+	server := &http.Server{
+		Handler:                      http.HandlerFunc(s.handleFunc),
+		DisableGeneralOptionsHandler: true,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				listener.Close()
+			}
+		},
+	}
+	server.SetKeepAlivesEnabled(keepAlives)
+
+	go server.Serve(listener)
+	go func() {
+		select {
+		case <-listener.done:
+		case <-s.stopped:
+			server.Close()
+		}
+	}()
+}
+
+// WeightedResponse is a response picked by RegisterWeighted with a
+// probability proportional to its Weight.
+type WeightedResponse struct {
+	Weight   int
+	Response Response
+}
+
+// RegisterWeighted serves one of responses per request, picked at random
+// according to their weights.
+func (s *Server) RegisterWeighted(method, path string, responses []WeightedResponse) {
+	s.RegisterWeightedSeeded(method, path, responses, time.Now().UnixNano())
+}
+
+// RegisterWeightedSeeded is like RegisterWeighted, with the random selection
+// seeded by seed so the sequence of responses is reproducible.
+func (s *Server) RegisterWeightedSeeded(method, path string, responses []WeightedResponse, seed int64) {
+	total := 0
+	for _, weighted := range responses {
+		total += weighted.Weight
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	lock := sync.Mutex{}
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if total <= 0 {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		lock.Lock()
+		pick := random.Intn(total)
+		lock.Unlock()
+
+		for _, weighted := range responses {
+			if pick < weighted.Weight {
+				weighted.Response.ServeHTTP(rw, r)
+				return
+			}
+			pick -= weighted.Weight
+		}
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterRandomPayload responds with statusCode and size pseudo-random
+// bytes generated from seed. The same seed always gives the same bytes, so a
+// failure found with it can be reproduced.
+func (s *Server) RegisterRandomPayload(method, path string, statusCode int, size int, seed int64) {
+	payload := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(payload)
+
+	s.RegisterPayload(method, path, statusCode, payload)
+}
+
+// RegisterWithEarlyHints sends a 103 Early Hints response carrying hints
+// before the final response.
+func (s *Server) RegisterWithEarlyHints(method, path string, hints http.Header, statusCode int, payload []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		for name, values := range hints {
+			for _, value := range values {
+				rw.Header().Add(name, value)
+			}
+		}
+
+		rw.WriteHeader(http.StatusEarlyHints)
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterUnavailable responds with a 503 and a Retry-After header carrying
+// retryAfter in whole seconds, rounded up.
+func (s *Server) RegisterUnavailable(method, path string, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterSlowUpload reads the request body at bytesPerSecond before
+// responding with okStatus, giving up if the request is cancelled. It panics
+// if bytesPerSecond is not positive.
+func (s *Server) RegisterSlowUpload(method, path string, bytesPerSecond int, okStatus int) {
+	const tick = 10 * time.Millisecond
+
+	if bytesPerSecond <= 0 {
+		panic(errors.Errorf("bytesPerSecond must be positive, got %d", bytesPerSecond))
+	}
+
+	chunkSize := bytesPerSecond * int(tick) / int(time.Second)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, chunkSize)
+		for {
+			n, err := io.ReadFull(r.Body, chunk)
+			if n > 0 && !sleep(r.Context(), time.Duration(n)*time.Second/time.Duration(bytesPerSecond)) {
+				return
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		rw.WriteHeader(okStatus)
+	}
+
+	s.RegisterHandler(method, path, handler)
+	s.skipCapture(method, path)
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// RegisterWithLastModified serves payload with a Last-Modified header of
+// modTime, responding with a 304 to requests whose If-Modified-Since is at or
+// after it.
+func (s *Server) RegisterWithLastModified(method, path string, modTime time.Time, statusCode int, payload []byte) {
+	modTime = modTime.UTC().Truncate(time.Second)
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.After(since) {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterHang never responds to requests for method and path, holding them
+// until the client gives up or the server is stopped.
+func (s *Server) RegisterHang(method, path string) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-s.stopped:
+		}
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterForHeaderValue serves the response keyed by the value of the
+// request's headerName header, or defaultResp when there is no entry for it.
+func (s *Server) RegisterForHeaderValue(method, path, headerName string, valueToResponse map[string]Response, defaultResp Response) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if resp, ok := valueToResponse[r.Header.Get(headerName)]; ok {
+			resp.ServeHTTP(rw, r)
+			return
+		}
+
+		defaultResp.ServeHTTP(rw, r)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterDegrading serves fastResp immediately until fastUntil has passed
+// since registration, and slowResp after slowDelay from then on.
+func (s *Server) RegisterDegrading(method, path string, fastUntil time.Duration, fastResp, slowResp Response, slowDelay time.Duration) {
+	slowAt := s.now().Add(fastUntil)
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if s.now().Before(slowAt) {
+			fastResp.ServeHTTP(rw, r)
+			return
+		}
+
+		if sleep(r.Context(), slowDelay) {
+			slowResp.ServeHTTP(rw, r)
+		}
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterTransform responds with statusCode and the request body passed
+// through transform, or with a 500 and the error if transform fails.
+func (s *Server) RegisterTransform(method, path string, transform func([]byte) ([]byte, error), statusCode int) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			body, err = transform(body)
+		}
+
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		rw.WriteHeader(statusCode)
+		rw.Write(body)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterFunc responds with the status code, body and headers fn returns for
+// each request.
+func (s *Server) RegisterFunc(method, path string, fn func(*http.Request) (int, []byte, http.Header)) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		statusCode, body, header := fn(r)
+		for name, values := range header {
+			rw.Header()[name] = values
+		}
+
+		rw.WriteHeader(statusCode)
+		rw.Write(body)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterNDJSON streams objects to GET requests for path as newline
+// delimited JSON, flushing after each one and waiting delayBetween before the
+// next. The stream stops early if the client goes away. Objects that can't be
+// encoded get a 500 before anything is sent.
+func (s *Server) RegisterNDJSON(path string, objects []interface{}, delayBetween time.Duration) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		lines := make([][]byte, 0, len(objects))
+		for _, object := range objects {
+			line, err := json.Marshal(object)
+			if err != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+			lines = append(lines, append(line, '\n'))
+		}
+
+		rw.Header().Set("Content-Type", "application/x-ndjson")
+		rw.WriteHeader(http.StatusOK)
+
+		flusher, _ := rw.(http.Flusher)
+		for i, line := range lines {
+			if i > 0 && delayBetween > 0 && !sleep(r.Context(), delayBetween) {
+				return
+			}
+
+			rw.Write(line)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	s.RegisterHandler("GET", path, handler)
+}
+
+// RegisterCounterResponse responds with template, replacing every {counter}
+// in it with the next value of a counter shared by all counter routes on the
+// server. The first call gets 1, and Reset starts the count over.
+func (s *Server) RegisterCounterResponse(method, path string, template string) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.counter++
+		counter := s.counter
+		s.lock.Unlock()
+
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(strings.Replace(template, "{counter}", strconv.Itoa(counter), -1)))
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterHeaderEcho responds with the value of the request's headerName
+// header, both as the body and in an X-Echoed-<headerName> header.
+func (s *Server) RegisterHeaderEcho(method, path, headerName string) {
+	echoed := "X-Echoed-" + http.CanonicalHeaderKey(headerName)
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(headerName)
+
+		rw.Header().Set(echoed, value)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(value))
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterChunked writes payload in chunkSize pieces, flushing after each, so
+// it is sent with chunked transfer encoding.
+func (s *Server) RegisterChunked(method, path string, statusCode int, payload []byte, chunkSize int) {
+	if chunkSize <= 0 {
+		chunkSize = len(payload)
+	}
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(statusCode)
+
+		flusher, _ := rw.(http.Flusher)
+		for start := 0; start < len(payload); start += chunkSize {
+			end := start + chunkSize
+			if end > len(payload) {
+				end = len(payload)
+			}
+
+			rw.Write(payload[start:end])
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterExpectContinue controls the response to requests sent with
+// "Expect: 100-continue". When accept is true the body is read, which sends
+// the 100 Continue, and statusCode and payload follow. Otherwise the request
+// gets a 417 without the client sending the body. Requests without the
+// header get statusCode and payload.
+func (s *Server) RegisterExpectContinue(method, path string, accept bool, statusCode int, payload []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if !accept && expectsContinue(r) {
+			rw.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		io.Copy(ioutil.Discard, r.Body)
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterEarlyResponse responds with statusCode and payload to requests for
+// method and path as soon as they arrive, without reading their body, and
+// closes the connection afterwards. Nothing of the body is recorded.
+func (s *Server) RegisterEarlyResponse(method, path string, statusCode int, payload []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Connection", "close")
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+
+	s.RegisterHandler(method, path, handler)
+	s.skipCapture(method, path)
+}
+
+// skipCapture makes requests for method and path reach their handler with the
+// body unread, for handlers that read it themselves at their own pace. The
+// body is then recorded as far as the handler read it.
+func (s *Server) skipCapture(method, path string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.uncaptured[routeKey{method: strings.ToLower(method), path: path}] = true
+}
+
+// skipsCapture reports whether route, which r resolved to, was registered with
+// skipCapture. It must be called with the lock held.
+func (s *Server) skipsCapture(r *http.Request, route string) bool {
+	method := strings.ToLower(r.Method)
+	if !s.registered(method, route) {
+		method = AnyMethod
+	}
+
+	return s.uncaptured[routeKey{method: method, path: route}]
+}
+
+// RegisterTrickle sends the headers straight away and then dribbles payload
+// out, waiting perByteDelay for every byte and flushing a few bytes at a time.
+// It gives up if the request is cancelled.
+func (s *Server) RegisterTrickle(method, path string, statusCode int, payload []byte, perByteDelay time.Duration) {
+	const tick = 10 * time.Millisecond
+
+	chunkSize := len(payload)
+	if perByteDelay > 0 {
+		chunkSize = int(tick / perByteDelay)
+	}
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		flusher, _ := rw.(http.Flusher)
+
+		rw.WriteHeader(statusCode)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		for start := 0; start < len(payload); start += chunkSize {
+			end := start + chunkSize
+			if end > len(payload) {
+				end = len(payload)
+			}
+
+			if !sleep(r.Context(), time.Duration(end-start)*perByteDelay) {
+				return
+			}
+
+			rw.Write(payload[start:end])
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterReaderFunc responds with statusCode and streams the body returned
+// by fn for each request, closing it afterwards if it is an io.Closer. The
+// streamed body is not kept: the response is recorded, for DumpRequests and
+// the Recorder, without it.
+func (s *Server) RegisterReaderFunc(method, path string, statusCode int, fn func(*http.Request) io.Reader) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		skipBodyCapture(rw)
+
+		body := fn(r)
+		if closer, ok := body.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		rw.WriteHeader(statusCode)
+		io.Copy(rw, body)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
+
+// RegisterWithoutContentType serves payload with no Content-Type header,
+// instead of the one net/http would sniff from it.
+func (s *Server) RegisterWithoutContentType(method, path string, statusCode int, payload []byte) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header()["Content-Type"] = nil
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+
+	s.RegisterHandler(method, path, handler)
+}
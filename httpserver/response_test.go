@@ -0,0 +1,1161 @@
+package httpserver_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestRegisterTimedSwitch(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	before := httpserver.Response{StatusCode: http.StatusOK, Body: []byte("old")}
+	after := httpserver.Response{StatusCode: http.StatusCreated, Body: []byte("new")}
+	server.RegisterTimedSwitch("GET", "/version", before, after, 100*time.Millisecond)
+
+	resp := makeRequest(t, server, "GET", "/version")
+	compareResponse(t, resp, http.StatusOK, []byte("old"))
+
+	time.Sleep(150 * time.Millisecond)
+
+	resp = makeRequest(t, server, "GET", "/version")
+	compareResponse(t, resp, http.StatusCreated, []byte("new"))
+
+	t.Run("Reset", func(t *testing.T) {
+		server.Reset()
+
+		resp := makeRequest(t, server, "GET", "/version")
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("Expected status code to be %d but it was %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+}
+
+func TestRegisterValidated(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	validate := func(body []byte) error {
+		if !bytes.HasPrefix(body, []byte("valid")) {
+			return errors.New("body must start with valid")
+		}
+		return nil
+	}
+	server.RegisterValidated("POST", "/upload", validate, http.StatusCreated, []byte("accepted"))
+
+	cases := []struct {
+		Name           string
+		Body           []byte
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"Valid", []byte("valid upload"), http.StatusCreated, []byte("accepted")},
+		{"Invalid", []byte("garbage"), http.StatusBadRequest, []byte("body must start with valid")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequestWithBody(t, server, "POST", "/upload", tc.Body)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestRegisterWithContentLength(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterWithContentLength("GET", "/short", 20, []byte("only ten b"))
+
+	conn := dialServer(t, server)
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET /short HTTP/1.1\r\nHost: fake\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if resp.Header.Get("Content-Length") != "20" {
+		t.Fatalf("Expected Content-Length to be %s, it was %s", "20", resp.Header.Get("Content-Length"))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected err to be %s, it was %v", io.ErrUnexpectedEOF, err)
+	}
+	if len(body) == 20 {
+		t.Fatalf("Expected body length to differ from the declared %d", 20)
+	}
+
+	t.Run("LongerThanDeclared", func(t *testing.T) {
+		server.RegisterWithContentLength("GET", "/long", 4, []byte("twelve bytes"))
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "GET /long HTTP/1.1\r\nHost: fake\r\n\r\n")
+		raw, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !bytes.Contains(raw, []byte("Content-Length: 4\r\n")) {
+			t.Fatalf("Expected Content-Length to be %s, got %q", "4", raw)
+		}
+		if !bytes.HasSuffix(raw, []byte("\r\n\r\ntwelve bytes")) {
+			t.Fatalf("Expected the whole payload on the wire, got %q", raw)
+		}
+	})
+}
+
+func TestRegisterIndexed(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	responses := map[int]httpserver.Response{
+		2: {StatusCode: http.StatusServiceUnavailable, Body: []byte("third")},
+	}
+	defaultResp := httpserver.Response{StatusCode: http.StatusOK, Body: []byte("default")}
+	server.RegisterIndexed("GET", "/flaky", responses, defaultResp)
+	server.RegisterPayload("GET", "/other", http.StatusOK, []byte("other"))
+
+	expected := []httpserver.Response{defaultResp, defaultResp, responses[2], defaultResp}
+	for _, expectedResp := range expected {
+		makeRequest(t, server, "GET", "/other")
+
+		resp := makeRequest(t, server, "GET", "/flaky")
+		compareResponse(t, resp, expectedResp.StatusCode, expectedResp.Body)
+	}
+}
+
+func TestRegisterRaw(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterRaw("GET", "/raw", []byte("HTTP/1.1 299 Odd Status\r\nX-Odd: yes\r\nContent-Length: 5\r\n\r\nhello"))
+
+	resp := makeRequest(t, server, "GET", "/raw")
+	if resp.Status != "299 Odd Status" {
+		t.Fatalf("Expected status to be %s, it was %s", "299 Odd Status", resp.Status)
+	}
+	if resp.Header.Get("X-Odd") != "yes" {
+		t.Fatalf("Expected X-Odd header to be %s, it was %s", "yes", resp.Header.Get("X-Odd"))
+	}
+	compareResponse(t, resp, 299, []byte("hello"))
+
+	if server.RequestCount() != 1 {
+		t.Fatalf("Expected request count to be %d, it was %d", 1, server.RequestCount())
+	}
+}
+
+func TestQueueResponseFor(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.QueueResponseFor("GET", "/queued", httpserver.Response{StatusCode: http.StatusAccepted, Body: []byte("first")})
+	server.QueueResponseFor("GET", "/queued", httpserver.Response{StatusCode: http.StatusOK, Body: []byte("second")})
+	server.QueueResponseFor("GET", "/unregistered", httpserver.Response{Body: []byte("only")})
+	server.RegisterPayload("GET", "/queued", http.StatusOK, []byte("static"))
+
+	resp := makeRequest(t, server, "POST", "/queued")
+	compareResponse(t, resp, http.StatusMethodNotAllowed, []byte{})
+
+	resp = makeRequest(t, server, "GET", "/queued")
+	compareResponse(t, resp, http.StatusAccepted, []byte("first"))
+
+	resp = makeRequest(t, server, "GET", "/queued")
+	compareResponse(t, resp, http.StatusOK, []byte("second"))
+
+	resp = makeRequest(t, server, "GET", "/queued")
+	compareResponse(t, resp, http.StatusOK, []byte("static"))
+
+	resp = makeRequest(t, server, "GET", "/unregistered")
+	compareResponse(t, resp, http.StatusOK, []byte("only"))
+
+	resp = makeRequest(t, server, "GET", "/unregistered")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+}
+
+func TestRegisterHTTP10(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHTTP10("GET", "/legacy", httpserver.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       []byte("legacy body"),
+	})
+
+	resp := makeRequest(t, server, "GET", "/legacy")
+	if resp.Proto != "HTTP/1.0" || resp.ProtoMajor != 1 || resp.ProtoMinor != 0 {
+		t.Fatalf("Expected protocol to be HTTP/1.0, it was %s", resp.Proto)
+	}
+	if resp.ContentLength != int64(len("legacy body")) {
+		t.Fatalf("Expected content length to be %d, it was %d", len("legacy body"), resp.ContentLength)
+	}
+	if len(resp.TransferEncoding) != 0 {
+		t.Fatalf("Expected no transfer encoding, got %v", resp.TransferEncoding)
+	}
+	if resp.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("Expected content type to be %s, it was %s", "text/plain", resp.Header.Get("Content-Type"))
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("legacy body"))
+}
+
+func TestRegisterWithConnectionClose(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterWithConnectionClose("GET", "/close", http.StatusOK, []byte("bye"))
+	server.RegisterPayload("GET", "/keep", http.StatusOK, []byte("hi"))
+
+	client := &http.Client{Transport: &http.Transport{}}
+	reused := func(path string) (*http.Response, bool) {
+		wasReused := false
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				wasReused = info.Reused
+			},
+		}
+
+		req, err := http.NewRequest("GET", server.Addr()+path, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		resp, err := client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, wasReused
+	}
+
+	reused("/keep")
+	if _, ok := reused("/keep"); !ok {
+		t.Fatal("Expected keep-alive connection to be reused")
+	}
+
+	resp, _ := reused("/close")
+	if !resp.Close {
+		t.Fatal("Expected response to carry Connection: close")
+	}
+
+	if _, ok := reused("/keep"); ok {
+		t.Fatal("Expected a fresh connection after Connection: close")
+	}
+}
+
+func TestRegisterForceKeepAlive(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterForceKeepAlive("GET", "/keep", http.StatusOK, []byte("kept"), true)
+	server.RegisterForceKeepAlive("GET", "/close", http.StatusOK, []byte("closed"), false)
+	server.RegisterPayload("GET", "/next", http.StatusOK, []byte("next"))
+
+	cases := []struct {
+		Name               string
+		Path               string
+		RequestConnection  string
+		ExpectedConnection string
+		ExpectedBody       []byte
+		ExpectedOpen       bool
+	}{
+		{"KeepDespiteClose", "/keep", "close", "keep-alive", []byte("kept"), true},
+		{"Keep", "/keep", "keep-alive", "keep-alive", []byte("kept"), true},
+		{"CloseDespiteKeepAlive", "/close", "keep-alive", "close", []byte("closed"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			conn := dialServer(t, server)
+			defer conn.Close()
+
+			fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: %s\r\n\r\n", tc.Path, tc.RequestConnection)
+
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			connection := resp.Header.Get("Connection")
+			if resp.Close {
+				connection = "close"
+			}
+			if connection != tc.ExpectedConnection {
+				t.Fatalf("Expected Connection header to be %s, it was %s", tc.ExpectedConnection, connection)
+			}
+			compareResponse(t, resp, http.StatusOK, tc.ExpectedBody)
+
+			conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			_, err = reader.Peek(1)
+			netErr, ok := err.(net.Error)
+			if open := ok && netErr.Timeout(); open != tc.ExpectedOpen {
+				t.Fatalf("Expected connection open to be %t, read returned: %v", tc.ExpectedOpen, err)
+			}
+			if !tc.ExpectedOpen {
+				return
+			}
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			fmt.Fprint(conn, "GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n")
+			resp, err = http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatalf("Expected the kept connection to serve the next request, got: %s", err)
+			}
+			compareResponse(t, resp, http.StatusOK, []byte("next"))
+		})
+	}
+
+	t.Run("KeepAlivesDisabled", func(t *testing.T) {
+		server.SetKeepAlivesEnabled(false)
+		defer server.SetKeepAlivesEnabled(true)
+
+		client := http.Client{Timeout: time.Second}
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(server.Addr() + "/keep")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			compareResponse(t, resp, http.StatusOK, []byte("kept"))
+		}
+	})
+}
+
+func TestRegisterWeighted(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	t.Run("SingleEntry", func(t *testing.T) {
+		server.RegisterWeighted("GET", "/single", []httpserver.WeightedResponse{
+			{Weight: 100, Response: httpserver.Response{StatusCode: http.StatusOK, Body: []byte("always")}},
+		})
+
+		for i := 0; i < 20; i++ {
+			resp := makeRequest(t, server, "GET", "/single")
+			compareResponse(t, resp, http.StatusOK, []byte("always"))
+		}
+	})
+
+	t.Run("Distribution", func(t *testing.T) {
+		server.RegisterWeightedSeeded("GET", "/weighted", []httpserver.WeightedResponse{
+			{Weight: 3, Response: httpserver.Response{StatusCode: http.StatusOK}},
+			{Weight: 1, Response: httpserver.Response{StatusCode: http.StatusServiceUnavailable}},
+		}, 42)
+
+		counts := map[int]int{}
+		for i := 0; i < 400; i++ {
+			resp := makeRequest(t, server, "GET", "/weighted")
+			resp.Body.Close()
+			counts[resp.StatusCode]++
+		}
+
+		if counts[http.StatusOK] < 260 || counts[http.StatusOK] > 340 {
+			t.Fatalf("Expected roughly 300 of 400 responses to be 200, got %d", counts[http.StatusOK])
+		}
+		if counts[http.StatusOK]+counts[http.StatusServiceUnavailable] != 400 {
+			t.Fatalf("Unexpected status codes: %v", counts)
+		}
+	})
+}
+
+func TestRegisterRandomPayload(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterRandomPayload("GET", "/a", http.StatusOK, 1024, 42)
+	server.RegisterRandomPayload("GET", "/b", http.StatusOK, 1024, 42)
+	server.RegisterRandomPayload("GET", "/c", http.StatusOK, 1024, 7)
+
+	read := func(path string) []byte {
+		t.Helper()
+
+		resp := makeRequest(t, server, "GET", path)
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(body) != 1024 {
+			t.Fatalf("Expected body size to be %d, it was %d", 1024, len(body))
+		}
+		return body
+	}
+
+	first := read("/a")
+	if !bytes.Equal(first, read("/a")) {
+		t.Fatal("Expected repeated calls to return the same bytes")
+	}
+	if !bytes.Equal(first, read("/b")) {
+		t.Fatal("Expected the same seed to give the same bytes")
+	}
+	if bytes.Equal(first, read("/c")) {
+		t.Fatal("Expected a different seed to give different bytes")
+	}
+}
+
+func TestRegisterWithEarlyHints(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	hints := http.Header{"Link": []string{"</style.css>; rel=preload; as=style"}}
+	server.RegisterWithEarlyHints("GET", "/page", hints, http.StatusOK, []byte("page"))
+
+	informational := []int{}
+	var link string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			link = header.Get("Link")
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", server.Addr()+"/page", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(informational) != 1 || informational[0] != http.StatusEarlyHints {
+		t.Fatalf("Expected a single %d response, got %v", http.StatusEarlyHints, informational)
+	}
+	if link != hints.Get("Link") {
+		t.Fatalf("Expected early hint Link to be %s, it was %s", hints.Get("Link"), link)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("page"))
+}
+
+func TestRegisterUnavailable(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	cases := []struct {
+		Name       string
+		RetryAfter time.Duration
+		Expected   string
+	}{
+		{"WholeSeconds", 30 * time.Second, "30"},
+		{"RoundsUp", 1500 * time.Millisecond, "2"},
+		{"Zero", 0, "0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server.RegisterUnavailable("GET", "/busy", tc.RetryAfter)
+
+			resp := makeRequest(t, server, "GET", "/busy")
+			compareResponse(t, resp, http.StatusServiceUnavailable, []byte{})
+			if retryAfter := resp.Header.Get("Retry-After"); retryAfter != tc.Expected {
+				t.Fatalf("Expected Retry-After to be %s, it was %s", tc.Expected, retryAfter)
+			}
+		})
+	}
+}
+
+func TestRegisterSlowUpload(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterSlowUpload("POST", "/upload", 4000, http.StatusCreated)
+
+	start := time.Now()
+	resp := makeRequestWithBody(t, server, "POST", "/upload", bytes.Repeat([]byte("a"), 1000))
+	elapsed := time.Since(start)
+
+	compareResponse(t, resp, http.StatusCreated, []byte{})
+	if elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("Expected upload to take about %s, it took %s", 250*time.Millisecond, elapsed)
+	}
+
+	t.Run("Cancellation", func(t *testing.T) {
+		server.RegisterSlowUpload("POST", "/crawl", 10, http.StatusCreated)
+
+		conn := dialServer(t, server)
+		fmt.Fprintf(conn, "POST /crawl HTTP/1.1\r\nHost: fakes\r\nContent-Length: 100\r\n\r\na")
+		server.WaitForRequest("POST", "/crawl", time.Second)
+		conn.Close()
+
+		start := time.Now()
+		for server.HandlerDurationNum(server.RequestCount()-1) == 0 {
+			if time.Since(start) > time.Second {
+				t.Fatal("Expected the handler to return once the request was cancelled")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("ReadsFromTheWire", func(t *testing.T) {
+		server := httpserver.New()
+		server.Start()
+		defer server.Stop()
+
+		server.RegisterSlowUpload("POST", "/upload", 4000, http.StatusCreated)
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nHost: fakes\r\nContent-Length: 100\r\n\r\n%s", bytes.Repeat([]byte("a"), 10))
+		if _, ok := server.WaitForRequest("POST", "/upload", time.Second); !ok {
+			t.Fatal("Expected the handler to start before the whole body was sent")
+		}
+
+		conn.Write(bytes.Repeat([]byte("a"), 90))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		compareResponse(t, resp, http.StatusCreated, []byte{})
+
+		if size := server.RequestBodySizeNum(0); size != 100 {
+			t.Fatalf("Expected request body size to be %d, it was %d", 100, size)
+		}
+	})
+
+	t.Run("NonPositiveRate", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected RegisterSlowUpload with a zero rate to panic")
+			}
+		}()
+
+		server.RegisterSlowUpload("POST", "/stalled", 0, http.StatusCreated)
+	})
+}
+
+func TestRegisterWithLastModified(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	modTime := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	server.RegisterWithLastModified("GET", "/doc", modTime, http.StatusOK, []byte("document"))
+
+	cases := []struct {
+		Name            string
+		IfModifiedSince string
+		ExpectedStatus  int
+		ExpectedBody    []byte
+	}{
+		{"NoValidator", "", http.StatusOK, []byte("document")},
+		{"SameTime", modTime.Format(http.TimeFormat), http.StatusNotModified, []byte{}},
+		{"Later", modTime.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified, []byte{}},
+		{"Earlier", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, []byte("document")},
+		{"Invalid", "yesterday", http.StatusOK, []byte("document")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.IfModifiedSince != "" {
+				header.Set("If-Modified-Since", tc.IfModifiedSince)
+			}
+
+			resp := makeRequestWithHeaders(t, server, "GET", "/doc", header)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+			if lastModified := resp.Header.Get("Last-Modified"); lastModified != modTime.Format(http.TimeFormat) {
+				t.Fatalf("Expected Last-Modified to be %s, it was %s", modTime.Format(http.TimeFormat), lastModified)
+			}
+		})
+	}
+}
+
+func TestRegisterHang(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHang("GET", "/blackhole")
+
+	waitForHandler := func(index int) {
+		t.Helper()
+
+		for start := time.Now(); server.HandlerDurationNum(index) == 0; time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatal("Expected the hanging handler to return")
+			}
+		}
+	}
+
+	client := http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := client.Get(server.Addr() + "/blackhole"); err == nil {
+		t.Fatal("Expected the client to time out")
+	}
+	waitForHandler(0)
+
+	t.Run("Stop", func(t *testing.T) {
+		errs := make(chan error)
+		go func() {
+			_, err := http.Get(server.Addr() + "/blackhole")
+			errs <- err
+		}()
+
+		for server.RequestCount() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := server.Stop(); err != nil {
+			t.Fatalf("Unexpected err: %s", err)
+		}
+		if err := <-errs; err == nil {
+			t.Fatal("Expected the client request to fail once the server stopped")
+		}
+		waitForHandler(1)
+	})
+}
+
+func TestRegisterForHeaderValue(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	responses := map[string]httpserver.Response{
+		"acme":   {StatusCode: http.StatusOK, Body: []byte("acme data")},
+		"globex": {StatusCode: http.StatusAccepted, Body: []byte("globex data")},
+	}
+	defaultResp := httpserver.Response{StatusCode: http.StatusForbidden, Body: []byte("unknown tenant")}
+	server.RegisterForHeaderValue("GET", "/data", "X-Tenant", responses, defaultResp)
+
+	cases := []struct {
+		Name     string
+		Tenant   string
+		Expected httpserver.Response
+	}{
+		{"Acme", "acme", responses["acme"]},
+		{"Globex", "globex", responses["globex"]},
+		{"Unknown", "initech", defaultResp},
+		{"Missing", "", defaultResp},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.Tenant != "" {
+				header.Set("X-Tenant", tc.Tenant)
+			}
+
+			resp := makeRequestWithHeaders(t, server, "GET", "/data", header)
+			compareResponse(t, resp, tc.Expected.StatusCode, tc.Expected.Body)
+		})
+	}
+}
+
+func TestRegisterDegrading(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	fast := httpserver.Response{StatusCode: http.StatusOK, Body: []byte("fast")}
+	slow := httpserver.Response{StatusCode: http.StatusOK, Body: []byte("slow")}
+	server.RegisterDegrading("GET", "/degrading", 100*time.Millisecond, fast, slow, 50*time.Millisecond)
+
+	start := time.Now()
+	resp := makeRequest(t, server, "GET", "/degrading")
+	compareResponse(t, resp, http.StatusOK, []byte("fast"))
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Fatalf("Expected fast response to take less than %s, it took %s", 50*time.Millisecond, elapsed)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	start = time.Now()
+	resp = makeRequest(t, server, "GET", "/degrading")
+	compareResponse(t, resp, http.StatusOK, []byte("slow"))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected slow response to take at least %s, it took %s", 50*time.Millisecond, elapsed)
+	}
+}
+
+func TestRegisterTransform(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	transform := func(body []byte) ([]byte, error) {
+		if len(body) == 0 {
+			return nil, errors.New("empty body")
+		}
+		return bytes.ToUpper(body), nil
+	}
+	server.RegisterTransform("POST", "/upper", transform, http.StatusOK)
+
+	cases := []struct {
+		Name           string
+		Body           []byte
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"Transformed", []byte("shout this"), http.StatusOK, []byte("SHOUT THIS")},
+		{"Failed", []byte{}, http.StatusInternalServerError, []byte("empty body")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequestWithBody(t, server, "POST", "/upper", tc.Body)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterFunc("GET", "/users/{id}", func(r *http.Request) (int, []byte, http.Header) {
+		header := http.Header{}
+		header.Set("X-User", httpserver.PathParam(r, "id"))
+		return http.StatusOK, []byte("user " + httpserver.PathParam(r, "id")), header
+	})
+
+	resp := makeRequest(t, server, "GET", "/users/42")
+	if resp.Header.Get("X-User") != "42" {
+		t.Fatalf("Expected X-User header to be %s, it was %s", "42", resp.Header.Get("X-User"))
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("user 42"))
+}
+
+func TestRegisterNDJSON(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	objects := []interface{}{
+		map[string]string{"level": "info", "msg": "started"},
+		map[string]string{"level": "warn", "msg": "slow"},
+	}
+	server.RegisterNDJSON("/logs", objects, 100*time.Millisecond)
+
+	start := time.Now()
+	resp := makeRequest(t, server, "GET", "/logs")
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Fatalf("Expected Content-Type to be %s, it was %s", "application/x-ndjson", contentType)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	expected := []string{`{"level":"info","msg":"started"}`, `{"level":"warn","msg":"slow"}`}
+	for i, expectedLine := range expected {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unexpected err: %s", err)
+		}
+		if line != expectedLine+"\n" {
+			t.Fatalf("Expected line %d to be %s, it was %s", i, expectedLine, line)
+		}
+		if i == 0 && time.Since(start) >= 100*time.Millisecond {
+			t.Fatalf("Expected the first line to be flushed before the delay, it took %s", time.Since(start))
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Expected the second line to arrive after the delay, it took %s", elapsed)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Fatalf("Expected the stream to end after %d lines, got err: %v", len(expected), err)
+	}
+}
+
+func TestRegisterCounterResponse(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterCounterResponse("POST", "/users", `{"id": {counter}}`)
+	server.RegisterCounterResponse("POST", "/orders", "order-{counter}")
+
+	cases := []struct {
+		Path         string
+		ExpectedBody string
+	}{
+		{"/users", `{"id": 1}`},
+		{"/users", `{"id": 2}`},
+		{"/orders", "order-3"},
+		{"/users", `{"id": 4}`},
+	}
+
+	for _, tc := range cases {
+		resp := makeRequest(t, server, "POST", tc.Path)
+		compareResponse(t, resp, http.StatusOK, []byte(tc.ExpectedBody))
+	}
+
+	t.Run("AfterReset", func(t *testing.T) {
+		server.Reset()
+		server.RegisterCounterResponse("POST", "/users", "{counter}")
+
+		resp := makeRequest(t, server, "POST", "/users")
+		compareResponse(t, resp, http.StatusOK, []byte("1"))
+	})
+}
+
+func TestRegisterHeaderEcho(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHeaderEcho("GET", "/echo", "x-request-id")
+
+	header := http.Header{}
+	header.Set("X-Request-Id", "abc-123")
+	resp := makeRequestWithHeaders(t, server, "GET", "/echo", header)
+
+	if echoed := resp.Header.Get("X-Echoed-X-Request-Id"); echoed != "abc-123" {
+		t.Fatalf("Expected X-Echoed-X-Request-Id header to be %s, it was %s", "abc-123", echoed)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("abc-123"))
+}
+
+func TestRegisterChunked(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterChunked("GET", "/chunked", http.StatusOK, []byte("hello world!"), 5)
+
+	t.Run("Reassembled", func(t *testing.T) {
+		resp := makeRequest(t, server, "GET", "/chunked")
+		if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+			t.Fatalf("Expected transfer encoding to be chunked, it was %v", resp.TransferEncoding)
+		}
+		compareResponse(t, resp, http.StatusOK, []byte("hello world!"))
+	})
+
+	t.Run("Framing", func(t *testing.T) {
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		fmt.Fprint(conn, "GET /chunked HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		raw, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("Unexpected err: %s", err)
+		}
+
+		expected := []byte("\r\n\r\n5\r\nhello\r\n5\r\n worl\r\n2\r\nd!\r\n0\r\n\r\n")
+		if !bytes.HasSuffix(raw, expected) {
+			t.Fatalf("Expected the body to be framed in chunks of 5, got:\n%s", raw)
+		}
+	})
+}
+
+func TestRegisterExpectContinue(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterExpectContinue("PUT", "/accept", true, http.StatusCreated, []byte("stored"))
+	server.RegisterExpectContinue("PUT", "/reject", false, http.StatusCreated, []byte("stored"))
+
+	cases := []struct {
+		Name             string
+		Path             string
+		ExpectedStatus   int
+		ExpectedBody     []byte
+		ExpectedContinue bool
+		ExpectedRecorded []byte
+	}{
+		{"Accept", "/accept", http.StatusCreated, []byte("stored"), true, []byte("upload")},
+		{"Reject", "/reject", http.StatusExpectationFailed, []byte{}, false, []byte{}},
+	}
+
+	client := http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+
+	for i, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got100 := false
+			trace := &httptrace.ClientTrace{
+				Got100Continue: func() { got100 = true },
+			}
+
+			req, err := http.NewRequest("PUT", server.Addr()+tc.Path, bytes.NewReader([]byte("upload")))
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			req.Header.Set("Expect", "100-continue")
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+
+			if got100 != tc.ExpectedContinue {
+				t.Fatalf("Expected 100 Continue to be received to be %t, it was %t", tc.ExpectedContinue, got100)
+			}
+			if body := server.RequestBodyNum(i); !bytes.Equal(body, tc.ExpectedRecorded) {
+				t.Fatalf("Expected recorded body to be %s, it was %s", tc.ExpectedRecorded, body)
+			}
+		})
+	}
+}
+
+func TestRegisterEarlyResponse(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterEarlyResponse("POST", "/upload", http.StatusRequestEntityTooLarge, []byte("too large"))
+
+	body := bytes.NewReader(make([]byte, 16<<20))
+	resp, err := http.Post(server.Addr()+"/upload", "application/octet-stream", body)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	compareResponse(t, resp, http.StatusRequestEntityTooLarge, []byte("too large"))
+
+	if !resp.Close {
+		t.Fatal("Expected the server to close the connection")
+	}
+	if size := server.RequestBodySizeNum(0); size != 0 {
+		t.Fatalf("Expected no body to be recorded, got %d bytes", size)
+	}
+
+	t.Run("NextRequest", func(t *testing.T) {
+		server.RegisterPayload("GET", "/next", http.StatusOK, []byte("next"))
+
+		resp := makeRequest(t, server, "GET", "/next")
+		compareResponse(t, resp, http.StatusOK, []byte("next"))
+	})
+
+	cases := []struct {
+		Name   string
+		Method string
+		Path   string
+		URI    string
+	}{
+		{Name: "Pattern", Method: "POST", Path: "/upload/{id}", URI: "/upload/1"},
+		{Name: "AnyMethod", Method: httpserver.AnyMethod, Path: "/any", URI: "/any"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			server := httpserver.New()
+			server.Start()
+			defer server.Stop()
+
+			server.RegisterEarlyResponse(c.Method, c.Path, http.StatusRequestEntityTooLarge, []byte("too large"))
+
+			resp := makeRequestWithBody(t, server, "POST", c.URI, make([]byte, 64<<10))
+			compareResponse(t, resp, http.StatusRequestEntityTooLarge, []byte("too large"))
+
+			if size := server.RequestBodySizeNum(0); size != 0 {
+				t.Fatalf("Expected no body to be recorded, got %d bytes", size)
+			}
+		})
+	}
+
+	t.Run("Overridden", func(t *testing.T) {
+		server := httpserver.New()
+		server.Start()
+		defer server.Stop()
+
+		server.RegisterEarlyResponse("POST", "/upload", http.StatusRequestEntityTooLarge, []byte("too large"))
+		server.RegisterPayload("POST", "/upload", http.StatusOK, []byte("ok"))
+
+		resp := makeRequestWithBody(t, server, "POST", "/upload", []byte("body"))
+		compareResponse(t, resp, http.StatusOK, []byte("ok"))
+
+		if size := server.RequestBodySizeNum(0); size != 4 {
+			t.Fatalf("Expected the body to be recorded, got %d bytes", size)
+		}
+	})
+}
+
+func TestRegisterTrickle(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	payload := []byte("a slowly dribbled body")
+	perByteDelay := 5 * time.Millisecond
+	server.RegisterTrickle("GET", "/trickle", http.StatusOK, payload, perByteDelay)
+
+	total := time.Duration(len(payload)) * perByteDelay
+
+	start := time.Now()
+	resp := makeRequest(t, server, "GET", "/trickle")
+	if elapsed := time.Since(start); elapsed >= total {
+		t.Fatalf("Expected headers before the body finished trickling, they took %s", elapsed)
+	}
+
+	compareResponse(t, resp, http.StatusOK, payload)
+	if elapsed := time.Since(start); elapsed < total {
+		t.Fatalf("Expected the transfer to take at least %s, it took %s", total, elapsed)
+	}
+
+	t.Run("Cancelled", func(t *testing.T) {
+		client := http.Client{Timeout: total / 2}
+		resp, err := client.Get(server.Addr() + "/trickle")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer resp.Body.Close()
+
+		if _, err := ioutil.ReadAll(resp.Body); err == nil {
+			t.Fatal("Expected the client to time out mid-body")
+		}
+	})
+}
+
+type closeTracker struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c *closeTracker) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestRegisterReaderFunc(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	const size = 1 << 20
+
+	body := &closeTracker{Reader: io.LimitReader(zeroReader{}, size), closed: make(chan struct{})}
+	server.RegisterReaderFunc("GET", "/large", http.StatusOK, func(r *http.Request) io.Reader {
+		return body
+	})
+
+	resp := makeRequest(t, server, "GET", "/large")
+	defer resp.Body.Close()
+
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+	if n != size {
+		t.Fatalf("Expected body size to be %d, it was %d", size, n)
+	}
+
+	select {
+	case <-body.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the generated body to be closed")
+	}
+}
+
+type responseSink struct {
+	lock      sync.Mutex
+	responses []*httpserver.Response
+}
+
+func (s *responseSink) Record(server string, request httpserver.CapturedRequest, response *httpserver.Response) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.responses = append(s.responses, response)
+}
+
+func (s *responseSink) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.responses)
+}
+
+func TestRegisterReaderFuncDoesNotRetainBody(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	recorded := &responseSink{}
+	server.SetRecorder(recorded)
+
+	const size = 1 << 20
+	server.RegisterReaderFunc("GET", "/large", http.StatusOK, func(r *http.Request) io.Reader {
+		return io.LimitReader(zeroReader{}, size)
+	})
+
+	resp := makeRequest(t, server, "GET", "/large")
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	for start := time.Now(); recorded.count() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("Expected the exchange to be recorded")
+		}
+	}
+
+	if bytesOut := server.Metrics().BytesOut; bytesOut != size {
+		t.Fatalf("Expected %d bytes to be sent, got %d", size, bytesOut)
+	}
+
+	recorded.lock.Lock()
+	defer recorded.lock.Unlock()
+
+	if len(recorded.responses) != 1 || recorded.responses[0].StatusCode != http.StatusOK {
+		t.Fatalf("Expected the response to be recorded, got %v", recorded.responses)
+	}
+	if n := len(recorded.responses[0].Body); n != 0 {
+		t.Fatalf("Expected the streamed body not to be retained, %d bytes were", n)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestRegisterWithoutContentType(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	payload := []byte("<html><body>hello</body></html>")
+	server.RegisterPayload("GET", "/sniffed", http.StatusOK, payload)
+	server.RegisterWithoutContentType("GET", "/plain", http.StatusOK, payload)
+
+	resp := makeRequest(t, server, "GET", "/sniffed")
+	if resp.Header.Get("Content-Type") == "" {
+		t.Fatal("Expected net/http to sniff a Content-Type for a registered payload")
+	}
+
+	resp = makeRequest(t, server, "GET", "/plain")
+	compareResponse(t, resp, http.StatusOK, payload)
+	if values, ok := resp.Header["Content-Type"]; ok {
+		t.Fatalf("Expected no Content-Type header, got %v", values)
+	}
+}
@@ -0,0 +1,451 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type contextKey int
+
+const (
+	paramsKey contextKey = iota
+	indexKey
+)
+
+const (
+	stubRoute          = "HandlerStub"
+	methodDefaultRoute = "MethodDefault"
+	catchAllRoute      = "CatchAll"
+	failAfterRoute     = "FailAfterRequests"
+)
+
+// AnyMethod registers a route for every method on a path. It is accepted by
+// RegisterHandler and the helpers built on it, RegisterURIRegexp,
+// QueueResponseFor and RegisterForContentType. Routes registered for the
+// request's own method take precedence over it.
+const AnyMethod = "*"
+
+type threshold struct {
+	requests int
+	handler  http.HandlerFunc
+}
+
+type routeKey struct {
+	method string
+	path   string
+}
+
+type matcher struct {
+	description string
+	match       func(*http.Request) bool
+	handler     http.HandlerFunc
+}
+
+type uriRoute struct {
+	method  string
+	pattern *regexp.Regexp
+	handler http.HandlerFunc
+}
+
+type patternRoute struct {
+	pattern  string
+	segments []string
+	methods  map[string]http.HandlerFunc
+}
+
+// PathParam returns the value of the {name} segment of the route that
+// matched r, or an empty string if there is none.
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+// RequestIndex returns the index r was recorded at, as used by RequestNum,
+// or -1 if r was not received by a Server.
+func RequestIndex(r *http.Request) int {
+	index, ok := r.Context().Value(indexKey).(int)
+	if !ok {
+		return -1
+	}
+	return index
+}
+
+func isPattern(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+// registered reports whether a handler is already registered for method and
+// path, exact or pattern.
+func (s *Server) registered(method, path string) bool {
+	method = strings.ToLower(method)
+
+	if _, ok := s.responses[path][method]; ok {
+		return true
+	}
+
+	for _, route := range s.patterns {
+		if route.pattern == path {
+			_, ok := route.methods[method]
+			return ok
+		}
+	}
+
+	return false
+}
+
+func (s *Server) registerPattern(method, path string, handler http.HandlerFunc) {
+	for _, route := range s.patterns {
+		if route.pattern == path {
+			route.methods[strings.ToLower(method)] = handler
+			return
+		}
+	}
+
+	s.patterns = append(s.patterns, &patternRoute{
+		pattern:  path,
+		segments: strings.Split(path, "/"),
+		methods:  map[string]http.HandlerFunc{strings.ToLower(method): handler},
+	})
+}
+
+// RegisterMethodDefault responds with statusCode and payload to requests
+// using method that no route or matcher handles, instead of a 404 or 405.
+func (s *Server) RegisterMethodDefault(method string, statusCode int, payload []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.defaults[strings.ToLower(method)] = func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+}
+
+// RegisterCatchAll responds with statusCode and payload to any request no
+// route, matcher or method default handles, instead of a 404 or 405. Those
+// requests are still recorded, and MatchedRouteNum reports them as
+// "CatchAll" and not matched.
+func (s *Server) RegisterCatchAll(statusCode int, payload []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.catchAll = func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(statusCode)
+		rw.Write(payload)
+	}
+}
+
+// FailAfterRequests responds with statusCode and payload to every request
+// once more than n have been recorded, whatever route they are for, until
+// Reset. The first n requests are routed as usual.
+func (s *Server) FailAfterRequests(n int, statusCode int, payload []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failAfter = &threshold{
+		requests: n,
+		handler: func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(statusCode)
+			rw.Write(payload)
+		},
+	}
+}
+
+// UnmatchedCount returns the number of requests since the last Reset that no
+// route, matcher or method default handled, whether they got a 404, a 405 or
+// the RegisterCatchAll response.
+func (s *Server) UnmatchedCount() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.unmatched
+}
+
+// RequireQueryParam responds with a 400 to any request without a name query
+// parameter, before it is routed. It applies until Reset.
+func (s *Server) RequireQueryParam(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.required = append(s.required, name)
+}
+
+func (s *Server) missingQueryParam(r *http.Request) bool {
+	if len(s.required) == 0 {
+		return false
+	}
+
+	query := r.URL.Query()
+	for _, name := range s.required {
+		if _, ok := query[name]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RegisterURIRegexp routes requests for method whose request URI, the raw
+// path and query as sent by the client, matches pattern to handler. Values of
+// named groups are available to the handler through PathParam. URI routes
+// are tried in registration order, after exact and pattern routes and before
+// matchers.
+func (s *Server) RegisterURIRegexp(method string, pattern *regexp.Regexp, handler http.HandlerFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.uriRoutes = append(s.uriRoutes, &uriRoute{
+		method:  strings.ToLower(method),
+		pattern: pattern,
+		handler: handler,
+	})
+}
+
+// RegisterMatcher routes any request for which match returns true to
+// handler. Matchers are only consulted when no exact path or pattern route
+// matches, in registration order. match is called with the server lock held,
+// before the body is read, and must neither read the body nor call back into
+// the server.
+func (s *Server) RegisterMatcher(match func(*http.Request) bool, handler http.HandlerFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.registerMatcher(fmt.Sprintf("matcher #%d", len(s.matchers)+1), match, handler)
+}
+
+// RegisterNamedMatcher is RegisterMatcher, describing the matcher as name in
+// MatcherOrder and MatchedRouteNum.
+func (s *Server) RegisterNamedMatcher(name string, match func(*http.Request) bool, handler http.HandlerFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.registerMatcher(name, match, handler)
+}
+
+func (s *Server) registerMatcher(description string, match func(*http.Request) bool, handler http.HandlerFunc) {
+	s.matchers = append(s.matchers, &matcher{
+		description: description,
+		match:       match,
+		handler:     handler,
+	})
+}
+
+// MatcherOrder returns the descriptions of the matchers registered with
+// RegisterMatcher and RegisterNamedMatcher in the order they are tried.
+// Unnamed matchers are described as "matcher #N", N being their registration
+// order, which they keep when reordered. Routes registered with
+// RegisterURIRegexp are not included: they are always tried before matchers,
+// in registration order.
+func (s *Server) MatcherOrder() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	order := make([]string, 0, len(s.matchers))
+	for _, matcher := range s.matchers {
+		order = append(order, matcher.description)
+	}
+
+	return order
+}
+
+// Prioritize moves the matcher at index in MatcherOrder to the front, so it
+// is tried before the others. It panics if there is no matcher at index. Use
+// TryPrioritize to get an error instead.
+func (s *Server) Prioritize(index int) {
+	if err := s.TryPrioritize(index); err != nil {
+		panic(err)
+	}
+}
+
+// TryPrioritize is Prioritize, returning an error instead of panicking when
+// there is no matcher at index.
+func (s *Server) TryPrioritize(index int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if index < 0 || index >= len(s.matchers) {
+		return errors.Errorf("no matcher at index %d, there are %d", index, len(s.matchers))
+	}
+
+	prioritized := s.matchers[index]
+	matchers := append([]*matcher{prioritized}, s.matchers[:index]...)
+	s.matchers = append(matchers, s.matchers[index+1:]...)
+	return nil
+}
+
+// RegisterForContentType routes requests for method and path whose
+// Content-Type matches contentType, ignoring parameters such as charset, to
+// handler. Requests with other content types go to the handler registered
+// with RegisterHandler for the route, or get a 415 if there is none.
+func (s *Server) RegisterForContentType(method, path, contentType string, handler http.HandlerFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := routeKey{method: strings.ToLower(method), path: path}
+	if _, ok := s.contentTypes[key]; !ok {
+		s.contentTypes[key] = map[string]http.HandlerFunc{}
+	}
+
+	s.contentTypes[key][mediaType(contentType)] = handler
+}
+
+// routeFor returns the handler routed for r and the route that matched it,
+// trying queued responses, then exact paths (by content type first), then
+// patterns, then URI routes, then matchers, then method defaults. Within
+// each of those but matchers and defaults, a route for the request's method
+// is preferred to one for AnyMethod.
+func (s *Server) routeFor(r *http.Request) (http.HandlerFunc, string, bool) {
+	method := strings.ToLower(r.Method)
+	keys := []routeKey{{method: method, path: r.URL.Path}, {method: AnyMethod, path: r.URL.Path}}
+
+	for _, key := range keys {
+		if resp, ok := s.dequeue(key); ok {
+			return resp.ServeHTTP, r.URL.Path, true
+		}
+	}
+
+	byContentType := false
+	for _, key := range keys {
+		if handlers, ok := s.contentTypes[key]; ok {
+			byContentType = true
+			if handler, ok := handlers[mediaType(r.Header.Get("Content-Type"))]; ok {
+				return handler, r.URL.Path, true
+			}
+		}
+	}
+
+	if handler, ok := methodHandler(s.responses[r.URL.Path], method); ok {
+		return handler, r.URL.Path, true
+	}
+
+	if byContentType {
+		return statusHandler(http.StatusUnsupportedMediaType), r.URL.Path, true
+	}
+
+	for _, route := range s.patterns {
+		params, ok := route.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		if handler, ok := methodHandler(route.methods, method); ok {
+			return withParams(handler, params), route.pattern, true
+		}
+	}
+
+	for _, route := range s.uriRoutes {
+		if route.method != method && route.method != AnyMethod {
+			continue
+		}
+
+		if params, ok := route.match(r.RequestURI); ok {
+			return withParams(route.handler, params), route.pattern.String(), true
+		}
+	}
+
+	for _, matcher := range s.matchers {
+		if matcher.match(r) {
+			return matcher.handler, matcher.description, true
+		}
+	}
+
+	if handler, ok := s.defaults[method]; ok {
+		return handler, methodDefaultRoute, true
+	}
+
+	return nil, "", false
+}
+
+// methodHandler returns the handler in methods for method, falling back to
+// the one registered for AnyMethod.
+func methodHandler(methods map[string]http.HandlerFunc, method string) (http.HandlerFunc, bool) {
+	if handler, ok := methods[method]; ok {
+		return handler, true
+	}
+
+	handler, ok := methods[AnyMethod]
+	return handler, ok
+}
+
+// knownPath reports whether any exact or pattern route exists for path,
+// regardless of method.
+func (s *Server) knownPath(path string) bool {
+	if _, ok := s.responses[path]; ok {
+		return true
+	}
+
+	for key := range s.contentTypes {
+		if key.path == path {
+			return true
+		}
+	}
+
+	for _, route := range s.patterns {
+		if _, ok := route.match(path); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return parsed
+}
+
+func withParams(handler http.HandlerFunc, params map[string]string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), paramsKey, params)
+		handler(rw, r.WithContext(ctx))
+	}
+}
+
+func (p *patternRoute) match(path string) (map[string]string, bool) {
+	segments := strings.Split(path, "/")
+	if len(segments) != len(p.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range p.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func (u *uriRoute) match(uri string) (map[string]string, bool) {
+	submatches := u.pattern.FindStringSubmatch(uri)
+	if submatches == nil {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, name := range u.pattern.SubexpNames() {
+		if name != "" {
+			params[name] = submatches[i]
+		}
+	}
+
+	return params, true
+}
@@ -0,0 +1,628 @@
+package httpserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestPathParams(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("GET", "/users/{id}/posts/{post}", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(httpserver.PathParam(r, "id") + ":" + httpserver.PathParam(r, "post")))
+	})
+	server.RegisterPayload("GET", "/users/me/posts/latest", http.StatusOK, []byte("exact"))
+
+	cases := []struct {
+		Name           string
+		Method, Path   string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"Params", "GET", "/users/42/posts/7", http.StatusOK, []byte("42:7")},
+		{"ExactPrecedence", "GET", "/users/me/posts/latest", http.StatusOK, []byte("exact")},
+		{"EmptySegment", "GET", "/users//posts/7", http.StatusNotFound, []byte{}},
+		{"ExtraSegment", "GET", "/users/42/posts/7/comments", http.StatusNotFound, []byte{}},
+		{"MethodNotAllowed", "POST", "/users/42/posts/7", http.StatusMethodNotAllowed, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, tc.Method, tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestRequestIndex(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("GET", "/index", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "%d", httpserver.RequestIndex(r))
+	})
+
+	for i := 0; i < 3; i++ {
+		resp := makeRequest(t, server, "GET", "/index")
+		compareResponse(t, resp, http.StatusOK, []byte(fmt.Sprintf("%d", i)))
+	}
+
+	if index := httpserver.RequestIndex(server.RequestNum(1)); index != 1 {
+		t.Fatalf("Expected recorded request index to be %d, it was %d", 1, index)
+	}
+
+	r, _ := http.NewRequest("GET", "/index", nil)
+	if index := httpserver.RequestIndex(r); index != -1 {
+		t.Fatalf("Expected unrecorded request index to be %d, it was %d", -1, index)
+	}
+}
+
+func TestState(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("PUT", "/items/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		server.State().Store(httpserver.PathParam(r, "id"), body)
+		rw.WriteHeader(http.StatusCreated)
+	})
+	server.RegisterHandler("GET", "/items/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		item, ok := server.State().Load(httpserver.PathParam(r, "id"))
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write(item.([]byte))
+	})
+	server.RegisterHandler("DELETE", "/items/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		server.State().Delete(httpserver.PathParam(r, "id"))
+		rw.WriteHeader(http.StatusNoContent)
+	})
+
+	resp := makeRequest(t, server, "GET", "/items/1")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+
+	resp = makeRequestWithBody(t, server, "PUT", "/items/1", []byte("item one"))
+	compareResponse(t, resp, http.StatusCreated, []byte{})
+
+	resp = makeRequest(t, server, "GET", "/items/1")
+	compareResponse(t, resp, http.StatusOK, []byte("item one"))
+
+	resp = makeRequest(t, server, "GET", "/items/2")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+
+	resp = makeRequest(t, server, "DELETE", "/items/1")
+	compareResponse(t, resp, http.StatusNoContent, []byte{})
+
+	resp = makeRequest(t, server, "GET", "/items/1")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+
+	t.Run("Reset", func(t *testing.T) {
+		server.State().Store("1", []byte("item one"))
+		server.Reset()
+
+		if _, ok := server.State().Load("1"); ok {
+			t.Fatal("Expected state to be cleared by Reset")
+		}
+	})
+}
+
+func TestRegisterMatcher(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterMatcher(func(r *http.Request) bool {
+		return r.Header.Get("X-Tenant") == "acme"
+	}, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("acme"))
+	})
+	server.RegisterMatcher(func(r *http.Request) bool {
+		return r.Header.Get("X-Tenant") != ""
+	}, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("any tenant"))
+	})
+	server.RegisterPayload("GET", "/exact", http.StatusOK, []byte("exact"))
+
+	cases := []struct {
+		Name           string
+		Path, Tenant   string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"FirstMatcher", "/anything", "acme", http.StatusOK, []byte("acme")},
+		{"RegistrationOrder", "/anything", "initech", http.StatusOK, []byte("any tenant")},
+		{"ExactPrecedence", "/exact", "acme", http.StatusOK, []byte("exact")},
+		{"NoMatch", "/anything", "", http.StatusNotFound, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.Tenant != "" {
+				header.Set("X-Tenant", tc.Tenant)
+			}
+
+			resp := makeRequestWithHeaders(t, server, "GET", tc.Path, header)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	for _, body := range []string{"any tenant", "acme", "initech"} {
+		body := body
+		server.RegisterMatcher(func(r *http.Request) bool {
+			return body == "any tenant" || r.Header.Get("X-Tenant") == body
+		}, func(rw http.ResponseWriter, r *http.Request) {
+			rw.Write([]byte(body))
+		})
+	}
+
+	request := func(t *testing.T) *http.Response {
+		t.Helper()
+		return makeRequestWithHeaders(t, server, "GET", "/anything", http.Header{"X-Tenant": []string{"acme"}})
+	}
+
+	resp := request(t)
+	compareResponse(t, resp, http.StatusOK, []byte("any tenant"))
+
+	server.Prioritize(1)
+
+	expected := []string{"matcher #2", "matcher #1", "matcher #3"}
+	if order := server.MatcherOrder(); strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected matcher order to be %v, it was %v", expected, order)
+	}
+
+	resp = request(t)
+	compareResponse(t, resp, http.StatusOK, []byte("acme"))
+
+	route, _ := server.MatchedRouteNum(1)
+	if route != "matcher #2" {
+		t.Fatalf("Expected matched route to be %s, it was %s", "matcher #2", route)
+	}
+
+	t.Run("Named", func(t *testing.T) {
+		server.RegisterNamedMatcher("initech only", func(r *http.Request) bool {
+			return r.Header.Get("X-Tenant") == "initech"
+		}, func(rw http.ResponseWriter, r *http.Request) {
+			rw.Write([]byte("initech only"))
+		})
+
+		server.Prioritize(3)
+
+		expected := []string{"initech only", "matcher #2", "matcher #1", "matcher #3"}
+		if order := server.MatcherOrder(); strings.Join(order, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Expected matcher order to be %v, it was %v", expected, order)
+		}
+	})
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		for _, index := range []int{-1, 4} {
+			if err := server.TryPrioritize(index); err == nil {
+				t.Fatalf("Expected prioritizing index %d to fail", index)
+			}
+		}
+
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected Prioritize with no matchers to panic")
+			}
+		}()
+
+		httpserver.New().Prioritize(0)
+	})
+}
+
+func TestRegisterMethodDefault(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/users", http.StatusOK, []byte("users"))
+	server.RegisterPayload("GET", "/users/{id}", http.StatusOK, []byte("user"))
+	server.RegisterPayload("POST", "/allowed", http.StatusCreated, []byte("created"))
+	server.RegisterMethodDefault("POST", http.StatusServiceUnavailable, []byte("maintenance"))
+
+	cases := []struct {
+		Name           string
+		Method, Path   string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"ExactGet", "GET", "/users", http.StatusOK, []byte("users")},
+		{"PatternGet", "GET", "/users/42", http.StatusOK, []byte("user")},
+		{"SpecificPost", "POST", "/allowed", http.StatusCreated, []byte("created")},
+		{"PostToGetRoute", "POST", "/users", http.StatusServiceUnavailable, []byte("maintenance")},
+		{"PostToUnknownPath", "POST", "/anything", http.StatusServiceUnavailable, []byte("maintenance")},
+		{"OtherMethod", "GET", "/anything", http.StatusNotFound, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, tc.Method, tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestAnyMethodQueuesAndContentTypes(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.QueueResponseFor(httpserver.AnyMethod, "/queued", httpserver.Response{Body: []byte("any queued")})
+	server.QueueResponseFor("GET", "/queued", httpserver.Response{Body: []byte("get queued")})
+	server.RegisterForContentType(httpserver.AnyMethod, "/typed", "application/json", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("json"))
+	})
+
+	cases := []struct {
+		Name           string
+		Method, Path   string
+		ContentType    string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"QueuedExactMethodFirst", "GET", "/queued", "", http.StatusOK, []byte("get queued")},
+		{"QueuedAnyMethod", "GET", "/queued", "", http.StatusOK, []byte("any queued")},
+		{"QueuesEmpty", "PATCH", "/queued", "", http.StatusNotFound, []byte{}},
+		{"ContentTypeAnyMethod", "PUT", "/typed", "application/json", http.StatusOK, []byte("json")},
+		{"ContentTypeMismatch", "POST", "/typed", "text/plain", http.StatusUnsupportedMediaType, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequestWithHeaders(t, server, tc.Method, tc.Path, http.Header{"Content-Type": []string{tc.ContentType}})
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestAnyMethodPrecedence(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload(httpserver.AnyMethod, "/items", http.StatusOK, []byte("any item"))
+	server.RegisterPayload("GET", "/items", http.StatusOK, []byte("get item"))
+	server.RegisterPayload(httpserver.AnyMethod, "/items/{id}", http.StatusOK, []byte("any pattern"))
+	server.RegisterPayload("DELETE", "/items/{id}", http.StatusOK, []byte("delete pattern"))
+	server.RegisterPayload("PUT", "/other", http.StatusOK, []byte("put other"))
+	server.RegisterMethodDefault("POST", http.StatusServiceUnavailable, []byte("default"))
+
+	cases := []struct {
+		Name           string
+		Method, Path   string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"ExactMethodOverAny", "GET", "/items", http.StatusOK, []byte("get item")},
+		{"AnyMethodOnExactPath", "PATCH", "/items", http.StatusOK, []byte("any item")},
+		{"AnyMethodOverDefault", "POST", "/items", http.StatusOK, []byte("any item")},
+		{"PatternExactMethodOverAny", "DELETE", "/items/1", http.StatusOK, []byte("delete pattern")},
+		{"PatternAnyMethod", "GET", "/items/1", http.StatusOK, []byte("any pattern")},
+		{"NoAnyMethod", "GET", "/other", http.StatusMethodNotAllowed, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, tc.Method, tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+
+	t.Run("StubOverAll", func(t *testing.T) {
+		server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Write([]byte("stub"))
+		})
+		defer server.ClearHandlerStub()
+
+		resp := makeRequest(t, server, "GET", "/items")
+		compareResponse(t, resp, http.StatusOK, []byte("stub"))
+	})
+}
+
+func TestRegisterCatchAll(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/users", http.StatusOK, []byte("users"))
+	server.RegisterCatchAll(http.StatusTeapot, []byte("unmatched"))
+
+	cases := []struct {
+		Name           string
+		Method, Path   string
+		ExpectedStatus int
+		ExpectedBody   []byte
+		ExpectedRoute  string
+		ExpectedMatch  bool
+	}{
+		{"Matched", "GET", "/users", http.StatusOK, []byte("users"), "/users", true},
+		{"UnknownPath", "GET", "/anything", http.StatusTeapot, []byte("unmatched"), "CatchAll", false},
+		{"UnknownMethod", "DELETE", "/users", http.StatusTeapot, []byte("unmatched"), "CatchAll", false},
+	}
+
+	for i, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, tc.Method, tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+
+			route, matched := server.MatchedRouteNum(i)
+			if route != tc.ExpectedRoute || matched != tc.ExpectedMatch {
+				t.Fatalf("Expected matched route to be %s (%t), it was %s (%t)", tc.ExpectedRoute, tc.ExpectedMatch, route, matched)
+			}
+		})
+	}
+
+	if server.RequestCount() != 3 {
+		t.Fatalf("Expected request count to be %d, it was %d", 3, server.RequestCount())
+	}
+	if server.UnmatchedCount() != 2 {
+		t.Fatalf("Expected unmatched count to be %d, it was %d", 2, server.UnmatchedCount())
+	}
+
+	t.Run("AfterReset", func(t *testing.T) {
+		server.Reset()
+
+		if server.UnmatchedCount() != 0 {
+			t.Fatalf("Expected unmatched count to be %d, it was %d", 0, server.UnmatchedCount())
+		}
+
+		resp := makeRequest(t, server, "GET", "/anything")
+		compareResponse(t, resp, http.StatusNotFound, []byte{})
+
+		if server.UnmatchedCount() != 1 {
+			t.Fatalf("Expected unmatched count to be %d, it was %d", 1, server.UnmatchedCount())
+		}
+	})
+}
+
+func TestFailAfterRequests(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/users", http.StatusOK, []byte("users"))
+	server.FailAfterRequests(2, http.StatusServiceUnavailable, []byte("degraded"))
+
+	cases := []struct {
+		Name           string
+		Path           string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"First", "/users", http.StatusOK, []byte("users")},
+		{"Second", "/unknown", http.StatusNotFound, []byte{}},
+		{"Third", "/users", http.StatusServiceUnavailable, []byte("degraded")},
+		{"Fourth", "/unknown", http.StatusServiceUnavailable, []byte("degraded")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, "GET", tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+
+	t.Run("AfterReset", func(t *testing.T) {
+		server.Reset()
+		server.RegisterPayload("GET", "/users", http.StatusOK, []byte("users"))
+
+		for i := 0; i < 3; i++ {
+			resp := makeRequest(t, server, "GET", "/users")
+			compareResponse(t, resp, http.StatusOK, []byte("users"))
+		}
+	})
+}
+
+func TestRequireQueryParam(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/data", http.StatusOK, []byte("data"))
+	server.RequireQueryParam("api_key")
+
+	cases := []struct {
+		Name           string
+		Path           string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"Present", "/data?api_key=secret", http.StatusOK, []byte("data")},
+		{"PresentUnknownPath", "/missing?api_key=secret", http.StatusNotFound, []byte{}},
+		{"Missing", "/data", http.StatusBadRequest, []byte{}},
+		{"OtherParam", "/data?key=secret", http.StatusBadRequest, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, "GET", tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+
+	t.Run("Reset", func(t *testing.T) {
+		server.Reset()
+		server.RegisterPayload("GET", "/data", http.StatusOK, []byte("data"))
+
+		resp := makeRequest(t, server, "GET", "/data")
+		compareResponse(t, resp, http.StatusOK, []byte("data"))
+	})
+}
+
+func TestRegisterURIRegexp(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	pattern := regexp.MustCompile(`^/search\?q=(?P<term>[a-z]+)&page=(?P<page>[0-9]+)$`)
+	server.RegisterURIRegexp("GET", pattern, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(httpserver.PathParam(r, "term") + ":" + httpserver.PathParam(r, "page")))
+	})
+	server.RegisterURIRegexp("GET", regexp.MustCompile(`^/search`), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("fallback"))
+	})
+	server.RegisterPayload("GET", "/search/exact", http.StatusOK, []byte("exact"))
+
+	cases := []struct {
+		Name           string
+		Method, Path   string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"NamedGroups", "GET", "/search?q=fakes&page=2", http.StatusOK, []byte("fakes:2")},
+		{"RegistrationOrder", "GET", "/search?q=fakes", http.StatusOK, []byte("fallback")},
+		{"ExactPrecedence", "GET", "/search/exact", http.StatusOK, []byte("exact")},
+		{"OtherMethod", "POST", "/search?q=fakes&page=2", http.StatusNotFound, []byte{}},
+		{"NoMatch", "GET", "/find?q=fakes", http.StatusNotFound, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequest(t, server, tc.Method, tc.Path)
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+}
+
+func TestUnusualPaths(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	t.Run("OptionsAsterisk", func(t *testing.T) {
+		server.RegisterHandler("OPTIONS", "*", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Allow", "GET, POST")
+			rw.WriteHeader(http.StatusNoContent)
+		})
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "OPTIONS * HTTP/1.1\r\nHost: fake\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected status code to be %d but it was %d", http.StatusNoContent, resp.StatusCode)
+		}
+		if allow := resp.Header.Get("Allow"); allow != "GET, POST" {
+			t.Fatalf("Expected Allow header to be %s, it was %s", "GET, POST", allow)
+		}
+
+		request := server.RequestNum(server.RequestCount() - 1)
+		if request.RequestURI != "*" {
+			t.Fatalf("Expected request URI to be %s, it was %s", "*", request.RequestURI)
+		}
+	})
+
+	t.Run("EncodedSlash", func(t *testing.T) {
+		server.RegisterPayload("GET", "/files/a/b", http.StatusOK, []byte("decoded"))
+		server.RegisterHandler("GET", "/files/{name}", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Write([]byte(httpserver.PathParam(r, "name")))
+		})
+
+		resp := makeRequest(t, server, "GET", "/files/a%2Fb")
+		compareResponse(t, resp, http.StatusOK, []byte("decoded"))
+
+		compareRequest(t, server.RequestNum(server.RequestCount()-1), "GET", "/files/a/b")
+	})
+}
+
+func TestMatchedRouteNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/users/me", http.StatusOK, []byte{})
+	server.RegisterPayload("GET", "/users/{id}", http.StatusOK, []byte{})
+	server.RegisterMatcher(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/any/")
+	}, func(rw http.ResponseWriter, r *http.Request) {})
+
+	cases := []struct {
+		Name            string
+		Method, Path    string
+		ExpectedRoute   string
+		ExpectedMatched bool
+	}{
+		{"Exact", "GET", "/users/me", "/users/me", true},
+		{"Param", "GET", "/users/42", "/users/{id}", true},
+		{"Matcher", "GET", "/any/thing", "matcher #1", true},
+		{"NotFound", "GET", "/missing", "", false},
+		{"MethodNotAllowed", "POST", "/users/42", "", false},
+	}
+
+	for i, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			makeRequest(t, server, tc.Method, tc.Path)
+
+			route, matched := server.MatchedRouteNum(i)
+			if route != tc.ExpectedRoute || matched != tc.ExpectedMatched {
+				t.Fatalf("Expected matched route to be (%q, %t), it was (%q, %t)", tc.ExpectedRoute, tc.ExpectedMatched, route, matched)
+			}
+		})
+	}
+}
+
+func TestRegisterForContentType(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterForContentType("POST", "/submit", "application/json", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("json"))
+	})
+	server.RegisterForContentType("POST", "/submit", "application/x-www-form-urlencoded", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("form"))
+	})
+	server.RegisterForContentType("POST", "/strict", "application/json", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("json"))
+	})
+	server.RegisterPayload("POST", "/submit", http.StatusOK, []byte("default"))
+
+	cases := []struct {
+		Name           string
+		Path           string
+		ContentType    string
+		ExpectedStatus int
+		ExpectedBody   []byte
+	}{
+		{"JSON", "/submit", "application/json; charset=utf-8", http.StatusOK, []byte("json")},
+		{"Form", "/submit", "application/x-www-form-urlencoded", http.StatusOK, []byte("form")},
+		{"Default", "/submit", "text/plain", http.StatusOK, []byte("default")},
+		{"Unsupported", "/strict", "text/plain", http.StatusUnsupportedMediaType, []byte{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := makeRequestWithHeaders(t, server, "POST", tc.Path, http.Header{"Content-Type": []string{tc.ContentType}})
+			compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+		})
+	}
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		resp := makeRequest(t, server, "GET", "/strict")
+		compareResponse(t, resp, http.StatusMethodNotAllowed, []byte{})
+	})
+}
@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// RegisterWithSchema validates the JSON body of requests for method and path
+// against schema, responding with 400 and the validation errors, one per
+// line, when it doesn't conform, or okStatus and okBody otherwise. It panics
+// if schema is not a valid JSON Schema.
+func (s *Server) RegisterWithSchema(method, path string, schema []byte, okStatus int, okBody []byte) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		panic(errors.Wrap(err, "compiling JSON schema"))
+	}
+
+	validate := func(body []byte) error {
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(body))
+		if err != nil {
+			return errors.Wrap(err, "validating JSON body")
+		}
+
+		if result.Valid() {
+			return nil
+		}
+
+		violations := make([]string, 0, len(result.Errors()))
+		for _, violation := range result.Errors() {
+			violations = append(violations, violation.String())
+		}
+		return errors.New(strings.Join(violations, "\n"))
+	}
+
+	s.RegisterValidated(method, path, validate, okStatus, okBody)
+}
@@ -0,0 +1,57 @@
+package httpserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestRegisterWithSchema(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	schema := []byte(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string"}
+		}
+	}`)
+	server.RegisterWithSchema("POST", "/users", schema, http.StatusCreated, []byte("created"))
+
+	t.Run("Valid", func(t *testing.T) {
+		resp := makeRequestWithBody(t, server, "POST", "/users", []byte(`{"name": "ada"}`))
+		compareResponse(t, resp, http.StatusCreated, []byte("created"))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		resp := makeRequestWithBody(t, server, "POST", "/users", []byte(`{"name": 42}`))
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status code to be %d but it was %d", http.StatusBadRequest, resp.StatusCode)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !strings.Contains(string(body), "name") {
+			t.Fatalf("Expected the validation errors to mention the name field, got: %s", body)
+		}
+	})
+
+	t.Run("InvalidSchema", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected RegisterWithSchema with an invalid schema to panic")
+			}
+		}()
+
+		server.RegisterWithSchema("POST", "/broken", []byte("{"), http.StatusOK, nil)
+	})
+}
@@ -1,63 +1,482 @@
 package httpserver
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 type Server struct {
-	listener    net.Listener
-	responses   map[string]map[string]http.HandlerFunc
-	requests    []*http.Request
-	handlerStub http.HandlerFunc
-	lock        sync.RWMutex
+	listener     net.Listener
+	listen       func(network, address string) (net.Listener, error)
+	startRetries int
+	startBackoff time.Duration
+	httpServer   *http.Server
+	scheme       string
+	stopped      chan struct{}
+	startedAt    time.Time
+	clock        Clock
+	keepAlives   bool
+	acceptDelay  time.Duration
+	maxConns     int
+	limiter      *limitListener
+	strict       bool
+	responses    map[string]map[string]http.HandlerFunc
+	patterns     []*patternRoute
+	uriRoutes    []*uriRoute
+	matchers     []*matcher
+	queues       map[routeKey][]Response
+	contentTypes map[routeKey]map[string]http.HandlerFunc
+	defaults     map[string]http.HandlerFunc
+	uncaptured   map[routeKey]bool
+	catchAll     http.HandlerFunc
+	failAfter    *threshold
+	unmatched    int
+	counter      int
+	required     []string
+	state        *sync.Map
+	requests     []*recordedRequest
+	expectations []*expectation
+	frames       map[string][][]byte
+	arrived      chan struct{}
+	paused       chan struct{}
+	handlerStub  http.HandlerFunc
+	lastPanic    interface{}
+	panicT       testing.TB
+	lock         sync.RWMutex
+
+	inFlight       []*recordedRequest
+	maxConcurrency int
+	connections    int
+	name           string
+	recorder       Recorder
+	sessionKey     SessionKey
+	resetCallbacks []func()
+}
+
+type recordedRequest struct {
+	request     *http.Request
+	started     time.Time
+	header      http.Header
+	proto       string
+	transfer    []string
+	tls         *tls.ConnectionState
+	body        []byte
+	lazyBody    *capturingBody
+	decoded     []byte
+	decodeError error
+	received    bool
+	route       string
+	matched     bool
+	bytesOut    int64
+	response    *Response
+	duration    time.Duration
 }
 
-func New() *Server {
-	return &Server{
-		responses: map[string]map[string]http.HandlerFunc{},
-		requests:  []*http.Request{},
-		lock:      sync.RWMutex{},
+// New returns a Server configured with opts. It is not listening until it is
+// started.
+func New(opts ...Option) *Server {
+	s := &Server{
+		keepAlives:   true,
+		listen:       net.Listen,
+		clock:        realClock{},
+		responses:    map[string]map[string]http.HandlerFunc{},
+		patterns:     []*patternRoute{},
+		uriRoutes:    []*uriRoute{},
+		matchers:     []*matcher{},
+		queues:       map[routeKey][]Response{},
+		contentTypes: map[routeKey]map[string]http.HandlerFunc{},
+		defaults:     map[string]http.HandlerFunc{},
+		uncaptured:   map[routeKey]bool{},
+		state:        &sync.Map{},
+		requests:     []*recordedRequest{},
+		frames:       map[string][][]byte{},
+		arrived:      make(chan struct{}),
+		lock:         sync.RWMutex{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
 func (s *Server) Start() error {
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	return s.StartOn("127.0.0.1:0")
+}
+
+// StartOn starts the server listening on addr, a host:port pair where port 0
+// picks a free port. Addr reports the address actually bound.
+func (s *Server) StartOn(addr string) error {
+	return s.start(addr, nil)
+}
+
+// StartTLS starts the server serving HTTPS on a free loopback port, using
+// config for the certificates and any client authentication. HTTP/2 is
+// negotiated with clients that support it. It fails if config can't be
+// served, such as when it has no certificate.
+func (s *Server) StartTLS(config *tls.Config) error {
+	return s.start("127.0.0.1:0", config)
+}
+
+func (s *Server) start(addr string, config *tls.Config) error {
+	listener, err := s.listenWithRetries(addr)
 	if err != nil {
 		return errors.Wrap(err, "creating listener")
 	}
 
+	ready := make(chan struct{})
 	s.listener = listener
-	go http.Serve(s.listener, http.HandlerFunc(s.handleFunc))
-	return nil
+	s.stopped = make(chan struct{})
+	s.connections = 0
+	s.startedAt = s.now()
+	s.httpServer = &http.Server{
+		Handler:                      http.HandlerFunc(s.handleFunc),
+		TLSConfig:                    config,
+		ConnState:                    s.trackConn,
+		DisableGeneralOptionsHandler: true,
+	}
+	s.httpServer.SetKeepAlivesEnabled(s.keepAlives)
+
+	s.lock.Lock()
+	s.limiter = newLimitListener(listener, s.maxConns, s.stopped)
+	limiter := s.limiter
+	s.lock.Unlock()
+
+	served := newReadyListener(newDelayListener(limiter, s.currentAcceptDelay, s.stopped), ready)
+	serveErr := make(chan error, 1)
+	if config != nil {
+		s.scheme = "https"
+		go func() { serveErr <- s.httpServer.ServeTLS(served, "", "") }()
+	} else {
+		s.scheme = "http"
+		go func() { serveErr <- s.httpServer.Serve(served) }()
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case err := <-serveErr:
+		listener.Close()
+		close(s.stopped)
+		return errors.Wrap(err, "serving")
+	}
+}
+
+// listenWithRetries listens on addr, trying again after the backoff set with
+// WithStartRetries when it fails, and returning the last error once the
+// retries run out.
+func (s *Server) listenWithRetries(addr string) (net.Listener, error) {
+	listener, err := s.listen("tcp", addr)
+	for retry := 0; err != nil && retry < s.startRetries; retry++ {
+		time.Sleep(s.startBackoff)
+		listener, err = s.listen("tcp", addr)
+	}
+
+	return listener, err
 }
 
 func (s *Server) Stop() error {
-	return s.listener.Close()
+	err := s.httpServer.Close()
+
+	select {
+	case <-s.stopped:
+	default:
+		close(s.stopped)
+	}
+
+	return err
+}
+
+// StartedAt returns when the server was last started, or the zero time if
+// it hasn't been.
+func (s *Server) StartedAt() time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.startedAt
+}
+
+// Uptime returns how long ago the server was last started, or zero if it
+// hasn't been.
+func (s *Server) Uptime() time.Duration {
+	startedAt := s.StartedAt()
+	if startedAt.IsZero() {
+		return 0
+	}
+
+	return s.now().Sub(startedAt)
+}
+
+// ConnectionCount returns the number of client connections the server has
+// accepted since it was started.
+func (s *Server) ConnectionCount() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.connections
+}
+
+func (s *Server) trackConn(conn net.Conn, state http.ConnState) {
+	if state != http.StateNew {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.connections++
 }
 
 func (s *Server) Reset() {
+	for _, callback := range s.clear() {
+		callback()
+	}
+}
+
+// OnReset registers fn to be called by Reset after the server state has been
+// cleared. Callbacks run in registration order and survive Reset.
+func (s *Server) OnReset(fn func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.resetCallbacks = append(s.resetCallbacks, fn)
+}
+
+// clear resets the server state and returns the callbacks registered with
+// OnReset, which are run once the lock is released.
+func (s *Server) clear() []func() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	s.responses = map[string]map[string]http.HandlerFunc{}
-	s.requests = []*http.Request{}
+	s.patterns = []*patternRoute{}
+	s.uriRoutes = []*uriRoute{}
+	s.matchers = []*matcher{}
+	s.queues = map[routeKey][]Response{}
+	s.contentTypes = map[routeKey]map[string]http.HandlerFunc{}
+	s.defaults = map[string]http.HandlerFunc{}
+	s.uncaptured = map[routeKey]bool{}
+	s.catchAll = nil
+	s.failAfter = nil
+	s.unmatched = 0
+	s.counter = 0
+	s.required = nil
+	s.state = &sync.Map{}
+	s.requests = []*recordedRequest{}
+	s.expectations = nil
+	s.frames = map[string][][]byte{}
 	s.handlerStub = nil
+	s.lastPanic = nil
+	s.maxConcurrency = len(s.inFlight)
+	s.resume()
+
+	return s.resetCallbacks
+}
+
+// SetKeepAlivesEnabled controls whether connections are kept alive between
+// requests. When disabled every response carries "Connection: close". It can
+// be called before or after Start.
+func (s *Server) SetKeepAlivesEnabled(enabled bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.keepAlives = enabled
+	if s.httpServer != nil {
+		s.httpServer.SetKeepAlivesEnabled(enabled)
+	}
+}
+
+// SetAcceptDelay makes the server wait for d before serving each new
+// connection, and before accepting the ones queued behind it. The kernel still
+// completes the TCP handshake, so clients see it as a slow first response
+// rather than a failed dial.
+func (s *Server) SetAcceptDelay(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.acceptDelay = d
+}
+
+// SetMaxConnections limits the server to serving n connections at once.
+// Further connections are queued, not refused: the kernel completes their
+// handshake, but the server only accepts them, in order, as served ones are
+// closed. A limit of 0 removes it. It can be called before or after Start.
+func (s *Server) SetMaxConnections(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.maxConns = n
+	if s.limiter != nil {
+		s.limiter.setLimit(n)
+	}
+}
+
+func (s *Server) currentAcceptDelay() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.acceptDelay
+}
+
+// AsHTTPTest returns a started httptest.Server backed by s, sharing its
+// routes and request recording. The caller is responsible for closing it.
+func (s *Server) AsHTTPTest() *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(s.handleFunc))
+	server.Config.DisableGeneralOptionsHandler = true
+	server.Start()
+	return server
 }
 
 func (s *Server) Addr() string {
-	return "http://" + s.listener.Addr().String()
+	return s.scheme + "://" + s.listener.Addr().String()
 }
 
+// RequestNum returns the request at index. Requests are indexed in the order
+// the server started handling them, before their bodies are read, so
+// concurrent requests get consecutive indexes in arrival order.
 func (s *Server) RequestNum(index int) *http.Request {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
-	return s.requests[index]
+	return s.requests[index].request
+}
+
+// RequestHeaderNum returns a copy of the headers of the request at index, as
+// they were when it was received.
+func (s *Server) RequestHeaderNum(index int) http.Header {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].header.Clone()
+}
+
+// RequestCookiesNum returns the cookies sent with the request at index, as
+// they were when it was received.
+func (s *Server) RequestCookiesNum(index int) []*http.Cookie {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	request := http.Request{Header: s.requests[index].header}
+	return request.Cookies()
+}
+
+// RequestProtoNum returns the protocol the request at index was received
+// over, such as "HTTP/1.1" or "HTTP/2.0".
+func (s *Server) RequestProtoNum(index int) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].proto
+}
+
+// RequestTransferEncodingNum returns the transfer encodings the request at
+// index was sent with, such as "chunked", or nil if its body had a known
+// length.
+func (s *Server) RequestTransferEncodingNum(index int) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]string(nil), s.requests[index].transfer...)
+}
+
+// RequestTLSNum returns the TLS connection state of the request at index, or
+// nil if it was not received over TLS.
+func (s *Server) RequestTLSNum(index int) *tls.ConnectionState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].tls
+}
+
+// RequestBodyNum returns the body of the request at index. Bodies are read
+// in full when the request is received, handlers can still read r.Body.
+// Requests sent with "Expect: 100-continue", and those to RegisterEarlyResponse
+// routes, are the exception: only what the handler read is recorded, once it
+// returns.
+func (s *Server) RequestBodyNum(index int) []byte {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].body
+}
+
+// LastRequestBody returns the body of the most recently received request, or
+// false if no request has been received yet.
+func (s *Server) LastRequestBody() ([]byte, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if s.requests[i].received {
+			return s.requests[i].body, true
+		}
+	}
+
+	return nil, false
+}
+
+// RequestBodySizeNum returns the size in bytes of the body of the request at
+// index.
+func (s *Server) RequestBodySizeNum(index int) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.requests[index].body)
+}
+
+// RequestBodyDecodedNum returns the body of the request at index, decoded
+// according to its Content-Encoding. Only gzip is supported, other encodings
+// return an error.
+func (s *Server) RequestBodyDecodedNum(index int) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].decoded, s.requests[index].decodeError
+}
+
+// RequestURINum returns the request-target of the request at index exactly as
+// the client sent it, query string included.
+func (s *Server) RequestURINum(index int) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].request.RequestURI
+}
+
+// HandlerDurationNum returns how long the handler for the request at index
+// took to run. It is zero until the handler returns.
+func (s *Server) HandlerDurationNum(index int) time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].duration
+}
+
+// MatchedRouteNum returns the route that handled the request at index: the
+// registered path or pattern, a matcher description, or "HandlerStub".
+// Requests answered with a 404, a 405 or by RegisterCatchAll report matched
+// as false.
+func (s *Server) MatchedRouteNum(index int) (pattern string, matched bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.requests[index].route, s.requests[index].matched
 }
 
 func (s *Server) RequestCount() int {
@@ -67,6 +486,126 @@ func (s *Server) RequestCount() int {
 	return len(s.requests)
 }
 
+// State returns a store shared by all handlers, useful for faking stateful
+// APIs. It is replaced with an empty store on Reset.
+func (s *Server) State() *sync.Map {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.state
+}
+
+// FailOnPanic makes any handler panic fail t, reporting the panic value and
+// the handler's stack, on top of the 500 response and LastPanic. It survives
+// Reset, and stops when t finishes, so panics after that don't touch it.
+func (s *Server) FailOnPanic(t testing.TB) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.panicT = t
+	t.Cleanup(func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if s.panicT == t {
+			s.panicT = nil
+		}
+	})
+}
+
+// LastPanic returns the value of the most recent handler panic since the
+// last Reset, or nil.
+func (s *Server) LastPanic() interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.lastPanic
+}
+
+// RequestsSince returns the requests recorded after marker, a value
+// previously returned by RequestCount.
+func (s *Server) RequestsSince(marker int) []*http.Request {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if marker < 0 {
+		marker = 0
+	}
+
+	requests := []*http.Request{}
+	for i := marker; i < len(s.requests); i++ {
+		requests = append(requests, s.requests[i].request)
+	}
+
+	return requests
+}
+
+// CapturedRequest is a recorded request together with what was captured when
+// it was received.
+type CapturedRequest struct {
+	Request *http.Request
+	Body    []byte
+	Query   url.Values
+	Header  http.Header
+}
+
+// CapturedFor returns the received requests for method and path, in the order
+// they were recorded.
+func (s *Server) CapturedFor(method, path string) []CapturedRequest {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	captured := []CapturedRequest{}
+	for _, request := range s.requests {
+		r := request.request
+		if !request.received || !strings.EqualFold(r.Method, method) || r.URL.Path != path {
+			continue
+		}
+
+		captured = append(captured, request.captured())
+	}
+
+	return captured
+}
+
+func (request *recordedRequest) captured() CapturedRequest {
+	return CapturedRequest{
+		Request: request.request,
+		Body:    request.body,
+		Query:   request.request.URL.Query(),
+		Header:  request.header.Clone(),
+	}
+}
+
+// InFlight returns the method and path of the requests whose handlers are
+// currently running, or held by Pause, in arrival order.
+func (s *Server) InFlight() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	inFlight := make([]string, 0, len(s.inFlight))
+	for _, request := range s.inFlight {
+		inFlight = append(inFlight, request.request.Method+" "+request.request.URL.Path)
+	}
+
+	return inFlight
+}
+
+// DrainRequests returns the requests recorded so far and clears them in a
+// single step, so no request is seen twice or missed between the two.
+func (s *Server) DrainRequests() []*http.Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	requests := make([]*http.Request, 0, len(s.requests))
+	for _, request := range s.requests {
+		requests = append(requests, request.request)
+	}
+
+	s.requests = []*recordedRequest{}
+	return requests
+}
+
 func (s *Server) HandlerStub(handler http.HandlerFunc) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -74,6 +613,19 @@ func (s *Server) HandlerStub(handler http.HandlerFunc) {
 	s.handlerStub = handler
 }
 
+// ClearHandlerStub removes the handler set by HandlerStub or Spy, leaving
+// routes and recorded requests in place.
+func (s *Server) ClearHandlerStub() {
+	s.HandlerStub(nil)
+}
+
+// Spy sends every request to handler, as HandlerStub does, while the server
+// keeps recording them. The request body is captured before handler runs, so
+// handler can read it and it is still available through RequestBodyNum.
+func (s *Server) Spy(handler http.HandlerFunc) {
+	s.HandlerStub(handler)
+}
+
 func (s *Server) RegisterPayload(method, path string, statusCode int, payload []byte) {
 	handler := func(rw http.ResponseWriter, r *http.Request) {
 		rw.WriteHeader(statusCode)
@@ -83,39 +635,355 @@ func (s *Server) RegisterPayload(method, path string, statusCode int, payload []
 	s.RegisterHandler(method, path, handler)
 }
 
+// RegisterStatus responds to method and path with statusCode and no body.
+func (s *Server) RegisterStatus(method, path string, statusCode int) {
+	s.RegisterPayload(method, path, statusCode, nil)
+}
+
+// RegisterHandler routes method and path to handler. Path segments written as
+// {name} match any single segment, and their value is available to the
+// handler through PathParam.
+//
+// method may be AnyMethod to handle every method on path. Routes are
+// resolved in this order, the first match handling the request:
+//
+//   - the response set with FailAfterRequests, once its threshold is crossed
+//   - the handler set by HandlerStub or Spy, for every request
+//   - responses queued with QueueResponseFor, for the request's method, then
+//     for AnyMethod
+//   - exact paths, for the request's method, then for AnyMethod, with
+//     RegisterForContentType routes tried first
+//   - patterns in registration order, each for the request's method, then
+//     for AnyMethod
+//   - RegisterURIRegexp routes, then matchers, in registration order
+//   - defaults set with RegisterMethodDefault, then RegisterCatchAll
+//
+// Paths are matched against the decoded r.URL.Path, so a request for
+// /a%2Fb is routed to /a/b. An "OPTIONS *" request is routed to the path "*".
+//
+// Handlers run without holding the server lock, so they can register new
+// routes themselves. Those apply from the next request on.
+//
+// A later registration for the same method and path replaces the earlier one,
+// unless the server was created WithStrictRegistration, in which case it
+// panics. It also panics if path contains a query, which would never match.
+// Use TryRegisterHandler to get an error instead.
 func (s *Server) RegisterHandler(method, path string, handler http.HandlerFunc) {
+	if err := s.TryRegisterHandler(method, path, handler); err != nil {
+		panic(err)
+	}
+}
+
+// TryRegisterHandler is RegisterHandler, returning an error instead of
+// panicking when the route can't be registered.
+func (s *Server) TryRegisterHandler(method, path string, handler http.HandlerFunc) error {
+	if strings.Contains(path, "?") {
+		return errors.Errorf("path %s contains a query: routes match the path only, use RegisterURIRegexp to match on the query", path)
+	}
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
+	return s.register(method, path, handler)
+}
+
+// register routes method and path to handler. It must be called with the lock
+// held.
+func (s *Server) register(method, path string, handler http.HandlerFunc) error {
+	if s.strict && s.registered(method, path) {
+		return errors.Errorf("route %s %s is already registered", strings.ToUpper(method), path)
+	}
+
+	delete(s.uncaptured, routeKey{method: strings.ToLower(method), path: path})
+
+	if isPattern(path) {
+		s.registerPattern(method, path, handler)
+		return nil
+	}
+
 	if _, ok := s.responses[path]; !ok {
 		s.responses[path] = map[string]http.HandlerFunc{}
 	}
 
 	s.responses[path][strings.ToLower(method)] = handler
+	return nil
+}
+
+// RegisterHandlerPaths routes method to handler under each of paths, as
+// RegisterHandler does for one.
+func (s *Server) RegisterHandlerPaths(method string, paths []string, handler http.HandlerFunc) {
+	for _, path := range paths {
+		s.RegisterHandler(method, path, handler)
+	}
 }
 
+// handleFunc records the request and resolves its handler while holding the
+// lock, but runs the handler without it. In-flight handlers are unaffected
+// by a concurrent Reset or registration, which only apply to new requests.
 func (s *Server) handleFunc(rw http.ResponseWriter, r *http.Request) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	request := s.record(r)
+	r = request.request
+	recorder := newResponseRecorder(rw)
 
-	s.requests = append(s.requests, r)
+	handler := s.receive(request)
+	defer s.finish(request, recorder)
+	defer drainBody(request)
 
-	if s.handlerStub != nil {
-		s.handlerStub(rw, r)
+	if !s.waitWhilePaused(r) {
 		return
 	}
 
-	methods, ok := s.responses[r.URL.Path]
-	if !ok {
-		rw.WriteHeader(http.StatusNotFound)
+	start := time.Now()
+	s.serve(handler, recorder, r)
+	recorder.duration = time.Since(start)
+}
+
+func (s *Server) serve(handler http.HandlerFunc, rw *responseRecorder, r *http.Request) {
+	defer s.recoverPanic(rw, r)
+
+	handler(rw, r)
+}
+
+// recoverPanic keeps a panicking handler from tearing down the connection,
+// storing the panic for LastPanic and responding with a 500 instead, unless
+// the response was already started or the connection hijacked. The panic
+// fails the test set with FailOnPanic, if any. http.ErrAbortHandler is passed
+// on, so handlers can still abort the response the standard way.
+func (s *Server) recoverPanic(rw *responseRecorder, r *http.Request) {
+	recovered := recover()
+	if recovered == nil {
 		return
 	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+
+	s.lock.Lock()
+	s.lastPanic = recovered
+	t := s.panicT
+	s.lock.Unlock()
+
+	if t != nil {
+		t.Errorf("Handler for %s %s panicked: %v\n%s", r.Method, r.URL.Path, recovered, debug.Stack())
+	}
 
-	handleFunc, ok := methods[strings.ToLower(r.Method)]
-	if !ok {
-		rw.WriteHeader(http.StatusMethodNotAllowed)
+	if !rw.hijacked && rw.statusCode == 0 {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// record appends r to the recorded requests before anything else is done
+// with it, which fixes its index.
+func (s *Server) record(r *http.Request) *recordedRequest {
+	request := &recordedRequest{
+		started:  s.now(),
+		header:   r.Header.Clone(),
+		proto:    r.Proto,
+		transfer: r.TransferEncoding,
+		tls:      r.TLS,
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ctx := context.WithValue(r.Context(), indexKey, len(s.requests))
+	request.request = r.WithContext(ctx)
+	s.requests = append(s.requests, request)
+	return request
+}
+
+// receive resolves the handler for the request, captures its body unless the
+// handler must see it unread, and marks the request as received.
+func (s *Server) receive(request *recordedRequest) http.HandlerFunc {
+	r := request.request
+
+	s.lock.Lock()
+	handler, route, matched := s.handlerFor(r)
+	request.route, request.matched = route, matched
+	lazy := expectsContinue(r) || s.skipsCapture(r, route)
+	s.lock.Unlock()
+
+	var body, decoded []byte
+	var decodeError error
+	if lazy {
+		request.lazyBody = newCapturingBody(r)
+	} else {
+		body = captureBody(r)
+		decoded, decodeError = decodeBody(request.header.Get("Content-Encoding"), body)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	request.body, request.decoded, request.decodeError = body, decoded, decodeError
+	request.received = true
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+
+	s.inFlight = append(s.inFlight, request)
+	if len(s.inFlight) > s.maxConcurrency {
+		s.maxConcurrency = len(s.inFlight)
+	}
+
+	return handler
+}
+
+// finish stores what was learned about the response once the handler
+// returned, and passes the exchange on to the Recorder if one is set.
+func (s *Server) finish(request *recordedRequest, recorder *responseRecorder) {
+	sink, name, captured, response := s.store(request, recorder)
+	if sink != nil {
+		sink.Record(name, captured, response)
+	}
+}
+
+func (s *Server) store(request *recordedRequest, recorder *responseRecorder) (Recorder, string, CapturedRequest, *Response) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, active := range s.inFlight {
+		if active == request {
+			s.inFlight = append(s.inFlight[:i:i], s.inFlight[i+1:]...)
+			break
+		}
+	}
+	request.bytesOut = recorder.written
+	request.response = recorder.response()
+	request.duration = recorder.duration
+
+	if request.lazyBody != nil {
+		request.body = request.lazyBody.Bytes()
+		request.decoded, request.decodeError = decodeBody(request.header.Get("Content-Encoding"), request.body)
+	}
+
+	if s.recorder == nil {
+		return nil, "", CapturedRequest{}, nil
+	}
+	return s.recorder, s.name, request.captured(), request.response
+}
+
+func (s *Server) handlerFor(r *http.Request) (http.HandlerFunc, string, bool) {
+	if s.missingQueryParam(r) {
+		return statusHandler(http.StatusBadRequest), "", false
+	}
+
+	if s.failAfter != nil && RequestIndex(r) >= s.failAfter.requests {
+		return s.failAfter.handler, failAfterRoute, true
+	}
+
+	if s.handlerStub != nil {
+		return s.handlerStub, stubRoute, true
+	}
+
+	if handler, route, ok := s.routeFor(r); ok {
+		return handler, route, true
+	}
+
+	s.unmatched++
+	if s.catchAll != nil {
+		return s.catchAll, catchAllRoute, false
+	}
+
+	if s.knownPath(r.URL.Path) {
+		return statusHandler(http.StatusMethodNotAllowed), "", false
+	}
+
+	return statusHandler(http.StatusNotFound), "", false
+}
+
+func statusHandler(statusCode int) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(statusCode)
+	}
+}
+
+func captureBody(r *http.Request) []byte {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+// drainBody reads what the handler left of a body it started reading but
+// didn't capture up front, as for "Expect: 100-continue" requests. net/http
+// only discards a little of it and then closes the connection, so a handler
+// reading part of a large upload would keep the connection from being
+// reused. Bodies the handler never touched are left alone, reading them
+// would ask the client to send what the handler chose not to. Drained bytes
+// are not recorded.
+func drainBody(request *recordedRequest) {
+	if request.lazyBody == nil || !request.lazyBody.Started() {
 		return
 	}
 
-	handleFunc(rw, r)
+	io.Copy(ioutil.Discard, request.lazyBody.ReadCloser)
+}
+
+// expectsContinue reports whether the client is waiting for a 100 Continue
+// before sending the body of r. Reading the body would send it, so it is left
+// for the handler to decide.
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue")
+}
+
+// capturingBody keeps a copy of what the handler reads of a request body
+// that could not be captured up front.
+type capturingBody struct {
+	io.ReadCloser
+	lock    sync.Mutex
+	buf     bytes.Buffer
+	started bool
+}
+
+func newCapturingBody(r *http.Request) *capturingBody {
+	body := &capturingBody{ReadCloser: r.Body}
+	r.Body = body
+	return body
+}
+
+func (c *capturingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+
+	c.lock.Lock()
+	c.started = true
+	c.buf.Write(p[:n])
+	c.lock.Unlock()
+
+	return n, err
+}
+
+// Started reports whether the handler has read from the body.
+func (c *capturingBody) Started() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.started
+}
+
+func (c *capturingBody) Bytes() []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]byte{}, c.buf.Bytes()...)
+}
+
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding gzip body")
+		}
+		defer reader.Close()
+
+		decoded, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding gzip body")
+		}
+		return decoded, nil
+	default:
+		return nil, errors.Errorf("unsupported content encoding %q", encoding)
+	}
 }
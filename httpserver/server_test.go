@@ -2,9 +2,15 @@ package httpserver_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/tscolari/gofakes/httpserver"
 )
@@ -25,6 +31,32 @@ func makeRequest(t *testing.T, server *httpserver.Server, method, path string) *
 	return resp
 }
 
+func makeRequestWithBody(t *testing.T, server *httpserver.Server, method, path string, body []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.Addr()+path, bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c := http.Client{}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return resp
+}
+
+func dialServer(t *testing.T, server *httpserver.Server) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.Addr(), "http://"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return conn
+}
+
 func compareRequest(t *testing.T, actual *http.Request, method, path string) {
 	t.Helper()
 
@@ -108,6 +140,56 @@ func TestRegisterHandler(t *testing.T) {
 	}
 }
 
+func TestRegisterHandlerPaths(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandlerPaths("GET", []string{"/v1/users", "/v2/users"}, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("users at " + r.URL.Path))
+	})
+
+	for _, path := range []string{"/v1/users", "/v2/users"} {
+		resp := makeRequest(t, server, "GET", path)
+		compareResponse(t, resp, http.StatusOK, []byte("users at "+path))
+	}
+
+	resp := makeRequest(t, server, "GET", "/v3/users")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status code to be %d but it was %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestTryRegisterHandlerWithQuery(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	handler := func(rw http.ResponseWriter, r *http.Request) {}
+
+	err := server.TryRegisterHandler("GET", "/search?q=fakes", handler)
+	if err == nil {
+		t.Fatal("Expected registering a path with a query to fail")
+	}
+	if !strings.Contains(err.Error(), "RegisterURIRegexp") {
+		t.Fatalf("Expected the error to point to RegisterURIRegexp, got: %s", err)
+	}
+
+	t.Run("Panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected RegisterPayload with a query to panic")
+			}
+		}()
+
+		server.RegisterPayload("GET", "/search?q=fakes", http.StatusOK, []byte{})
+	})
+
+	if err := server.TryRegisterHandler("GET", "/search", handler); err != nil {
+		t.Fatalf("Unexpected err: %s", err)
+	}
+}
+
 func TestNotFound(t *testing.T) {
 	server := httpserver.New()
 	server.Start()
@@ -216,3 +298,818 @@ func TestHandlerStub(t *testing.T) {
 		}
 	})
 }
+
+func TestClearHandlerStub(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("route"))
+	server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("stub"))
+	})
+
+	resp := makeRequest(t, server, "GET", "/hello")
+	compareResponse(t, resp, http.StatusOK, []byte("stub"))
+
+	server.ClearHandlerStub()
+
+	resp = makeRequest(t, server, "GET", "/hello")
+	compareResponse(t, resp, http.StatusOK, []byte("route"))
+
+	if server.RequestCount() != 2 {
+		t.Fatalf("Expected request count to be %d, it was %d", 2, server.RequestCount())
+	}
+}
+
+func TestSpy(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	real := http.NewServeMux()
+	real.HandleFunc("/echo", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write(append([]byte("real: "), body...))
+	})
+	server.Spy(real.ServeHTTP)
+
+	resp := makeRequestWithBody(t, server, "POST", "/echo", []byte("ping"))
+	compareResponse(t, resp, http.StatusAccepted, []byte("real: ping"))
+
+	if server.RequestCount() != 1 {
+		t.Fatalf("Expected request count to be %d, it was %d", 1, server.RequestCount())
+	}
+	compareRequest(t, server.RequestNum(0), "POST", "/echo")
+	if body := server.RequestBodyNum(0); !bytes.Equal(body, []byte("ping")) {
+		t.Fatalf("Expected recorded body to be %s, it was %s", "ping", body)
+	}
+}
+
+func TestRequestHeaderNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Token", "changed")
+	})
+
+	makeRequestWithHeaders(t, server, "GET", "/hello", http.Header{"X-Token": []string{"original"}})
+
+	if token := server.RequestHeaderNum(0).Get("X-Token"); token != "original" {
+		t.Fatalf("Expected header to be %s, it was %s", "original", token)
+	}
+}
+
+func TestRequestBodyNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	var handlerBody []byte
+	server.RegisterHandler("POST", "/hello", func(rw http.ResponseWriter, r *http.Request) {
+		handlerBody, _ = ioutil.ReadAll(r.Body)
+	})
+
+	makeRequestWithBody(t, server, "POST", "/hello", []byte("hello body"))
+	makeRequest(t, server, "GET", "/world")
+
+	if body := server.RequestBodyNum(0); !bytes.Equal(body, []byte("hello body")) {
+		t.Fatalf("Expected body to be %s, it was %s", "hello body", body)
+	}
+	if !bytes.Equal(handlerBody, []byte("hello body")) {
+		t.Fatalf("Expected handler to read body %s, it read %s", "hello body", handlerBody)
+	}
+	if body := server.RequestBodyNum(1); len(body) != 0 {
+		t.Fatalf("Expected body to be empty, it was %s", body)
+	}
+}
+
+func TestLastRequestBody(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	if _, ok := server.LastRequestBody(); ok {
+		t.Fatalf("Expected no last request body before any request")
+	}
+
+	makeRequestWithBody(t, server, "POST", "/hello", []byte("first body"))
+	makeRequestWithBody(t, server, "POST", "/hello", []byte("last body"))
+
+	body, ok := server.LastRequestBody()
+	if !ok {
+		t.Fatalf("Expected a last request body after a request")
+	}
+	if !bytes.Equal(body, []byte("last body")) {
+		t.Fatalf("Expected last body to be %s, it was %s", "last body", body)
+	}
+}
+
+func TestResetWithRequestsInFlight(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	register := func() {
+		server.RegisterHandler("GET", "/slow", func(rw http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			rw.WriteHeader(http.StatusOK)
+		})
+	}
+	register()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				resp, err := http.Get(server.Addr() + "/slow")
+				if err != nil {
+					t.Errorf("Unexpected err: %s", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+					t.Errorf("Expected status code to be %d or %d, it was %d", http.StatusOK, http.StatusNotFound, resp.StatusCode)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			server.Reset()
+			register()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+	<-done
+
+	server.Reset()
+	resp := makeRequest(t, server, "GET", "/slow")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status code to be %d but it was %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if server.RequestCount() != 1 {
+		t.Fatalf("Expected request count to be %d, it was %d", 1, server.RequestCount())
+	}
+}
+
+func TestAsHTTPTest(t *testing.T) {
+	server := httpserver.New()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+	testServer := server.AsHTTPTest()
+	defer testServer.Close()
+
+	resp, err := testServer.Client().Get(testServer.URL + "/hello")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("hello"))
+
+	if server.RequestCount() != 1 {
+		t.Fatalf("Expected request count to be %d, it was %d", 1, server.RequestCount())
+	}
+	compareRequest(t, server.RequestNum(0), "GET", "/hello")
+}
+
+func TestRequestBodyDecodedNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	post := func(encoding string, body []byte) {
+		req, err := http.NewRequest("POST", server.Addr()+"/upload", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("hello gzip"))
+	writer.Close()
+
+	post("gzip", compressed.Bytes())
+	post("", []byte("hello plain"))
+	post("br", []byte("hello brotli"))
+
+	t.Run("Gzip", func(t *testing.T) {
+		body, err := server.RequestBodyDecodedNum(0)
+		if err != nil {
+			t.Fatalf("Unexpected err: %s", err)
+		}
+		if !bytes.Equal(body, []byte("hello gzip")) {
+			t.Fatalf("Expected body to be %s, it was %s", "hello gzip", body)
+		}
+		if !bytes.Equal(server.RequestBodyNum(0), compressed.Bytes()) {
+			t.Fatal("Expected raw body to be the compressed bytes")
+		}
+	})
+
+	t.Run("Identity", func(t *testing.T) {
+		body, err := server.RequestBodyDecodedNum(1)
+		if err != nil {
+			t.Fatalf("Unexpected err: %s", err)
+		}
+		if !bytes.Equal(body, []byte("hello plain")) {
+			t.Fatalf("Expected body to be %s, it was %s", "hello plain", body)
+		}
+	})
+
+	t.Run("UnknownEncoding", func(t *testing.T) {
+		if _, err := server.RequestBodyDecodedNum(2); err == nil {
+			t.Fatal("Expected an error for an unsupported encoding")
+		}
+	})
+}
+
+func TestLastPanic(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	if server.LastPanic() != nil {
+		t.Fatalf("Expected no panic, got %v", server.LastPanic())
+	}
+
+	server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	resp := makeRequest(t, server, "GET", "/panic")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected status code to be %d but it was %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	if server.LastPanic() != "boom" {
+		t.Fatalf("Expected last panic to be %s, it was %v", "boom", server.LastPanic())
+	}
+
+	if server.RequestCount() != 1 {
+		t.Fatalf("Expected request count to be %d, it was %d", 1, server.RequestCount())
+	}
+	compareRequest(t, server.RequestNum(0), "GET", "/panic")
+
+	t.Run("AfterWriteHeader", func(t *testing.T) {
+		server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusCreated)
+			panic("late boom")
+		})
+
+		resp := makeRequest(t, server, "GET", "/panic")
+		compareResponse(t, resp, http.StatusCreated, []byte{})
+	})
+
+	t.Run("AbortHandler", func(t *testing.T) {
+		server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+
+		if _, err := http.Get(server.Addr() + "/abort"); err == nil {
+			t.Fatal("Expected the connection to be dropped")
+		}
+		if server.LastPanic() != "late boom" {
+			t.Fatalf("Expected last panic to be %s, it was %v", "late boom", server.LastPanic())
+		}
+	})
+}
+
+func TestFailOnPanic(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	tb := &fakeTB{}
+	server.FailOnPanic(tb)
+	server.Reset()
+
+	server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	resp := makeRequest(t, server, "GET", "/panic")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected status code to be %d but it was %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	if !tb.Failed() {
+		t.Fatal("Expected the panic to fail the test")
+	}
+	if !strings.Contains(tb.failures[0], "GET /panic panicked: boom") {
+		t.Fatalf("Expected failure to report the panic, got: %s", tb.failures[0])
+	}
+	if !strings.Contains(tb.failures[0], "goroutine") {
+		t.Fatalf("Expected failure to include the stack, got: %s", tb.failures[0])
+	}
+
+	t.Run("AfterTestFinished", func(t *testing.T) {
+		finished := &fakeTB{}
+		server.FailOnPanic(finished)
+		finished.finish()
+
+		resp := makeRequest(t, server, "GET", "/panic")
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("Expected status code to be %d but it was %d", http.StatusInternalServerError, resp.StatusCode)
+		}
+		if finished.Failed() {
+			t.Fatalf("Expected a finished test not to be failed, got: %v", finished.failures)
+		}
+	})
+}
+
+func TestOnReset(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	calls := []string{}
+	server.OnReset(func() {
+		calls = append(calls, "first")
+	})
+	server.OnReset(func() {
+		if server.RequestCount() != 0 {
+			t.Errorf("Expected requests to be cleared before the callback, got %d", server.RequestCount())
+		}
+		calls = append(calls, "second")
+	})
+
+	makeRequest(t, server, "GET", "/hello")
+	server.Reset()
+
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Fatalf("Expected callbacks to run in order, got %v", calls)
+	}
+
+	server.Reset()
+	if len(calls) != 4 {
+		t.Fatalf("Expected callbacks to run on every Reset, got %d calls", len(calls))
+	}
+}
+
+func TestDrainRequests(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequest(t, server, "POST", "/hello")
+	makeRequest(t, server, "GET", "/world")
+
+	requests := server.DrainRequests()
+	if len(requests) != 2 {
+		t.Fatalf("Expected %d drained requests, got %d", 2, len(requests))
+	}
+	compareRequest(t, requests[0], "POST", "/hello")
+	compareRequest(t, requests[1], "GET", "/world")
+
+	if server.RequestCount() != 0 {
+		t.Fatalf("Expected request count to be %d, it was %d", 0, server.RequestCount())
+	}
+
+	makeRequest(t, server, "GET", "/again")
+	requests = server.DrainRequests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected %d drained requests, got %d", 1, len(requests))
+	}
+	compareRequest(t, requests[0], "GET", "/again")
+}
+
+func TestSetKeepAlivesEnabled(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+	resp := makeRequest(t, server, "GET", "/hello")
+	if resp.Close {
+		t.Fatal("Expected keep-alives to be enabled by default")
+	}
+
+	server.SetKeepAlivesEnabled(false)
+
+	resp = makeRequest(t, server, "GET", "/hello")
+	if !resp.Close {
+		t.Fatal("Expected response to carry Connection: close")
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("hello"))
+}
+
+func TestUnreadBodyKeepsConnectionAlive(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("POST", "/upload", http.StatusAccepted, []byte("ignored"))
+
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+	client := http.Client{Transport: transport}
+
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(server.Addr()+"/upload", "text/plain", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		compareResponse(t, resp, http.StatusAccepted, []byte("ignored"))
+		resp.Body.Close()
+	}
+
+	if server.ConnectionCount() != 1 {
+		t.Fatalf("Expected connection count to be %d, it was %d", 1, server.ConnectionCount())
+	}
+	if server.RequestBodySizeNum(1) != len(body) {
+		t.Fatalf("Expected body size to be %d, it was %d", len(body), server.RequestBodySizeNum(1))
+	}
+}
+
+func TestPartiallyReadBodyKeepsConnectionAlive(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterHandler("POST", "/upload", func(rw http.ResponseWriter, r *http.Request) {
+		r.Body.Read(make([]byte, 1))
+		rw.WriteHeader(http.StatusAccepted)
+	})
+
+	transport := &http.Transport{ExpectContinueTimeout: 5 * time.Second}
+	defer transport.CloseIdleConnections()
+	client := http.Client{Transport: transport}
+
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", server.Addr()+"/upload", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		req.Header.Set("Expect", "100-continue")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		compareResponse(t, resp, http.StatusAccepted, []byte{})
+		resp.Body.Close()
+	}
+
+	if server.ConnectionCount() != 1 {
+		t.Fatalf("Expected connection count to be %d, it was %d", 1, server.ConnectionCount())
+	}
+	if server.RequestBodySizeNum(1) != 1 {
+		t.Fatalf("Expected only the byte read by the handler to be recorded, got %d", server.RequestBodySizeNum(1))
+	}
+}
+
+func TestStartedAt(t *testing.T) {
+	server := httpserver.New()
+
+	if !server.StartedAt().IsZero() {
+		t.Fatalf("Expected start time to be zero before Start, it was %s", server.StartedAt())
+	}
+	if server.Uptime() != 0 {
+		t.Fatalf("Expected uptime to be zero before Start, it was %s", server.Uptime())
+	}
+
+	before := time.Now()
+	server.Start()
+	defer server.Stop()
+
+	if server.StartedAt().Before(before) || server.StartedAt().After(time.Now()) {
+		t.Fatalf("Expected start time to be when Start was called, it was %s", server.StartedAt())
+	}
+
+	uptime := server.Uptime()
+	time.Sleep(10 * time.Millisecond)
+	if server.Uptime() < uptime+10*time.Millisecond {
+		t.Fatalf("Expected uptime to grow from %s, it was %s", uptime, server.Uptime())
+	}
+}
+
+func TestConnectionCount(t *testing.T) {
+	cases := []struct {
+		Name          string
+		Close         bool
+		ExpectedConns int
+	}{
+		{"KeepAlive", false, 1},
+		{"ConnectionClose", true, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httpserver.New()
+			server.Start()
+			defer server.Stop()
+			server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+			transport := &http.Transport{}
+			defer transport.CloseIdleConnections()
+			client := http.Client{Transport: transport}
+
+			for i := 0; i < 3; i++ {
+				req, err := http.NewRequest("GET", server.Addr()+"/hello", nil)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				req.Close = tc.Close
+
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				compareResponse(t, resp, http.StatusOK, []byte("hello"))
+			}
+
+			if count := server.ConnectionCount(); count != tc.ExpectedConns {
+				t.Fatalf("Expected connection count to be %d, it was %d", tc.ExpectedConns, count)
+			}
+		})
+	}
+}
+
+func TestCapturedFor(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	header := http.Header{}
+	header.Set("X-Attempt", "1")
+	makeRequestWithHeaders(t, server, "POST", "/orders?priority=high", header)
+	makeRequestWithBody(t, server, "POST", "/other", []byte("ignored"))
+	makeRequest(t, server, "GET", "/orders")
+	makeRequestWithBody(t, server, "POST", "/orders?priority=low", []byte("second order"))
+
+	captured := server.CapturedFor("post", "/orders")
+	if len(captured) != 2 {
+		t.Fatalf("Expected %d captured requests, got %d", 2, len(captured))
+	}
+
+	cases := []struct {
+		Name             string
+		ExpectedPriority string
+		ExpectedAttempt  string
+		ExpectedBody     []byte
+	}{
+		{"First", "high", "1", []byte{}},
+		{"Second", "low", "", []byte("second order")},
+	}
+
+	for i, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			compareRequest(t, captured[i].Request, "POST", "/orders")
+			if priority := captured[i].Query.Get("priority"); priority != tc.ExpectedPriority {
+				t.Fatalf("Expected priority to be %s, it was %s", tc.ExpectedPriority, priority)
+			}
+			if attempt := captured[i].Header.Get("X-Attempt"); attempt != tc.ExpectedAttempt {
+				t.Fatalf("Expected X-Attempt to be %s, it was %s", tc.ExpectedAttempt, attempt)
+			}
+			if !bytes.Equal(captured[i].Body, tc.ExpectedBody) {
+				t.Fatalf("Expected body to be %s, it was %s", tc.ExpectedBody, captured[i].Body)
+			}
+		})
+	}
+}
+
+func TestRequestURINum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequest(t, server, "GET", "/search?q=fake+server&page=2")
+	makeRequest(t, server, "GET", "/encoded%2Fpath")
+
+	if uri := server.RequestURINum(0); uri != "/search?q=fake+server&page=2" {
+		t.Fatalf("Expected request URI to be %s, it was %s", "/search?q=fake+server&page=2", uri)
+	}
+	if uri := server.RequestURINum(1); uri != "/encoded%2Fpath" {
+		t.Fatalf("Expected request URI to be %s, it was %s", "/encoded%2Fpath", uri)
+	}
+}
+
+func TestRequestTransferEncodingNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	req, err := http.NewRequest("POST", server.Addr()+"/upload", ioutil.NopCloser(strings.NewReader("chunked body")))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c := http.Client{}
+	if _, err := c.Do(req); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if encoding := server.RequestTransferEncodingNum(0); len(encoding) != 1 || encoding[0] != "chunked" {
+		t.Fatalf("Expected transfer encoding to be %v, it was %v", []string{"chunked"}, encoding)
+	}
+	if body := server.RequestBodyNum(0); string(body) != "chunked body" {
+		t.Fatalf("Expected body to be %s, it was %s", "chunked body", body)
+	}
+
+	makeRequestWithBody(t, server, "POST", "/upload", []byte("sized body"))
+	if encoding := server.RequestTransferEncodingNum(1); encoding != nil {
+		t.Fatalf("Expected no transfer encoding, got %v", encoding)
+	}
+}
+
+func TestRequestBodySizeNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequestWithBody(t, server, "POST", "/upload", bytes.Repeat([]byte("a"), 1024))
+	makeRequest(t, server, "GET", "/empty")
+
+	if size := server.RequestBodySizeNum(0); size != 1024 {
+		t.Fatalf("Expected body size to be %d, it was %d", 1024, size)
+	}
+	if size := server.RequestBodySizeNum(1); size != 0 {
+		t.Fatalf("Expected body size to be %d, it was %d", 0, size)
+	}
+}
+
+func TestRequestNumOrderingUnderConcurrency(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	const clients = 50
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Post(fmt.Sprintf("%s/client/%d", server.Addr(), i), "text/plain", strings.NewReader("body"))
+			if err != nil {
+				t.Errorf("Unexpected err: %s", err)
+				return
+			}
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	if server.RequestCount() != clients {
+		t.Fatalf("Expected request count to be %d, it was %d", clients, server.RequestCount())
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < clients; i++ {
+		request := server.RequestNum(i)
+		if request == nil {
+			t.Fatalf("Expected a request at index %d", i)
+		}
+		if seen[request.URL.Path] {
+			t.Fatalf("Request %s was recorded twice", request.URL.Path)
+		}
+		seen[request.URL.Path] = true
+
+		if body := server.RequestBodyNum(i); string(body) != "body" {
+			t.Fatalf("Expected body at index %d to be %s, it was %s", i, "body", body)
+		}
+	}
+}
+
+func TestRegisterStatus(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterStatus("GET", "/healthz", http.StatusNoContent)
+	server.RegisterStatus("GET", "/ok", http.StatusOK)
+
+	for _, tc := range []struct {
+		Path       string
+		StatusCode int
+	}{
+		{"/healthz", http.StatusNoContent},
+		{"/ok", http.StatusOK},
+	} {
+		resp := makeRequest(t, server, "GET", tc.Path)
+		compareResponse(t, resp, tc.StatusCode, []byte{})
+
+		if contentType, ok := resp.Header["Content-Type"]; ok {
+			t.Fatalf("Expected no content type for %s, got %v", tc.Path, contentType)
+		}
+	}
+}
+
+func TestRequestsSince(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	makeRequest(t, server, "GET", "/before")
+	makeRequest(t, server, "GET", "/before")
+	marker := server.RequestCount()
+
+	makeRequest(t, server, "POST", "/after")
+	makeRequest(t, server, "GET", "/after")
+
+	requests := server.RequestsSince(marker)
+	if len(requests) != 2 {
+		t.Fatalf("Expected %d requests since the marker, got %d", 2, len(requests))
+	}
+	compareRequest(t, requests[0], "POST", "/after")
+	compareRequest(t, requests[1], "GET", "/after")
+
+	if requests := server.RequestsSince(server.RequestCount()); len(requests) != 0 {
+		t.Fatalf("Expected no requests since the current count, got %d", len(requests))
+	}
+
+	server.Reset()
+	if requests := server.RequestsSince(marker); len(requests) != 0 {
+		t.Fatalf("Expected no requests after Reset, got %d", len(requests))
+	}
+}
+
+func TestRequestCookiesNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	req, err := http.NewRequest("GET", server.Addr()+"/session", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	resp.Body.Close()
+
+	cookies := server.RequestCookiesNum(0)
+	if len(cookies) != 2 {
+		t.Fatalf("Expected %d cookies, got %d", 2, len(cookies))
+	}
+	if cookies[0].Name != "session" || cookies[0].Value != "abc123" {
+		t.Fatalf("Expected cookie session=abc123, got %s=%s", cookies[0].Name, cookies[0].Value)
+	}
+	if cookies[1].Name != "theme" || cookies[1].Value != "dark" {
+		t.Fatalf("Expected cookie theme=dark, got %s=%s", cookies[1].Name, cookies[1].Value)
+	}
+}
+
+func TestRegisterFromHandler(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("POST", "/resources", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		server.RegisterPayload("GET", "/resources/1", http.StatusOK, body)
+		rw.WriteHeader(http.StatusCreated)
+	})
+
+	resp := makeRequest(t, server, "GET", "/resources/1")
+	compareResponse(t, resp, http.StatusNotFound, []byte{})
+
+	resp = makeRequestWithBody(t, server, "POST", "/resources", []byte("resource one"))
+	compareResponse(t, resp, http.StatusCreated, []byte{})
+
+	resp = makeRequest(t, server, "GET", "/resources/1")
+	compareResponse(t, resp, http.StatusOK, []byte("resource one"))
+}
+
+func TestHandlerDurationNum(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterHandler("GET", "/slow", func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+	server.RegisterPayload("GET", "/fast", http.StatusOK, []byte{})
+
+	makeRequest(t, server, "GET", "/slow")
+	makeRequest(t, server, "GET", "/fast")
+
+	if duration := server.HandlerDurationNum(0); duration < 50*time.Millisecond || duration > time.Second {
+		t.Fatalf("Expected handler duration to be about %s, it was %s", 50*time.Millisecond, duration)
+	}
+	if duration := server.HandlerDurationNum(1); duration >= 50*time.Millisecond {
+		t.Fatalf("Expected fast handler duration to be under %s, it was %s", 50*time.Millisecond, duration)
+	}
+}
@@ -0,0 +1,133 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// Snapshot is the configuration of a Server at the time Snapshot was called:
+// its routes, queued responses, handler stub and settings. Recorded requests,
+// expectations and State are not part of it.
+type Snapshot struct {
+	responses    map[string]map[string]http.HandlerFunc
+	patterns     []*patternRoute
+	uriRoutes    []*uriRoute
+	matchers     []*matcher
+	queues       map[routeKey][]Response
+	contentTypes map[routeKey]map[string]http.HandlerFunc
+	defaults     map[string]http.HandlerFunc
+	uncaptured   map[routeKey]bool
+	catchAll     http.HandlerFunc
+	failAfter    *threshold
+	required     []string
+	handlerStub  http.HandlerFunc
+	keepAlives   bool
+	acceptDelay  time.Duration
+	maxConns     int
+}
+
+// Snapshot captures the server configuration, to be brought back later with
+// Restore.
+func (s *Server) Snapshot() Snapshot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return Snapshot{
+		responses:    copyMethods(s.responses),
+		patterns:     copyPatterns(s.patterns),
+		uriRoutes:    append([]*uriRoute{}, s.uriRoutes...),
+		matchers:     append([]*matcher{}, s.matchers...),
+		queues:       copyQueues(s.queues),
+		contentTypes: copyContentTypes(s.contentTypes),
+		defaults:     copyHandlers(s.defaults),
+		uncaptured:   copyUncaptured(s.uncaptured),
+		catchAll:     s.catchAll,
+		failAfter:    s.failAfter,
+		required:     append([]string{}, s.required...),
+		handlerStub:  s.handlerStub,
+		keepAlives:   s.keepAlives,
+		acceptDelay:  s.acceptDelay,
+		maxConns:     s.maxConns,
+	}
+}
+
+// Restore replaces the server configuration with snapshot, leaving recorded
+// requests in place. snapshot can be restored any number of times.
+func (s *Server) Restore(snapshot Snapshot) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.responses = copyMethods(snapshot.responses)
+	s.patterns = copyPatterns(snapshot.patterns)
+	s.uriRoutes = append([]*uriRoute{}, snapshot.uriRoutes...)
+	s.matchers = append([]*matcher{}, snapshot.matchers...)
+	s.queues = copyQueues(snapshot.queues)
+	s.contentTypes = copyContentTypes(snapshot.contentTypes)
+	s.defaults = copyHandlers(snapshot.defaults)
+	s.uncaptured = copyUncaptured(snapshot.uncaptured)
+	s.catchAll = snapshot.catchAll
+	s.failAfter = snapshot.failAfter
+	s.required = append([]string{}, snapshot.required...)
+	s.handlerStub = snapshot.handlerStub
+	s.keepAlives = snapshot.keepAlives
+	s.acceptDelay = snapshot.acceptDelay
+	s.maxConns = snapshot.maxConns
+	if s.httpServer != nil {
+		s.httpServer.SetKeepAlivesEnabled(s.keepAlives)
+	}
+	if s.limiter != nil {
+		s.limiter.setLimit(s.maxConns)
+	}
+}
+
+func copyHandlers(handlers map[string]http.HandlerFunc) map[string]http.HandlerFunc {
+	copied := make(map[string]http.HandlerFunc, len(handlers))
+	for key, handler := range handlers {
+		copied[key] = handler
+	}
+	return copied
+}
+
+func copyMethods(responses map[string]map[string]http.HandlerFunc) map[string]map[string]http.HandlerFunc {
+	copied := make(map[string]map[string]http.HandlerFunc, len(responses))
+	for path, methods := range responses {
+		copied[path] = copyHandlers(methods)
+	}
+	return copied
+}
+
+func copyPatterns(patterns []*patternRoute) []*patternRoute {
+	copied := make([]*patternRoute, 0, len(patterns))
+	for _, route := range patterns {
+		copied = append(copied, &patternRoute{
+			pattern:  route.pattern,
+			segments: route.segments,
+			methods:  copyHandlers(route.methods),
+		})
+	}
+	return copied
+}
+
+func copyQueues(queues map[routeKey][]Response) map[routeKey][]Response {
+	copied := make(map[routeKey][]Response, len(queues))
+	for key, queue := range queues {
+		copied[key] = append([]Response{}, queue...)
+	}
+	return copied
+}
+
+func copyContentTypes(contentTypes map[routeKey]map[string]http.HandlerFunc) map[routeKey]map[string]http.HandlerFunc {
+	copied := make(map[routeKey]map[string]http.HandlerFunc, len(contentTypes))
+	for key, handlers := range contentTypes {
+		copied[key] = copyHandlers(handlers)
+	}
+	return copied
+}
+
+func copyUncaptured(uncaptured map[routeKey]bool) map[routeKey]bool {
+	copied := make(map[routeKey]bool, len(uncaptured))
+	for key, value := range uncaptured {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,86 @@
+package httpserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestSnapshot(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterPayload("GET", "/users", http.StatusOK, []byte("users"))
+	server.RegisterPayload("GET", "/users/{id}", http.StatusOK, []byte("user"))
+	baseline := server.Snapshot()
+
+	server.RegisterPayload("GET", "/users", http.StatusInternalServerError, []byte("broken"))
+	server.RegisterPayload("POST", "/users/{id}", http.StatusCreated, []byte("created"))
+	server.RegisterPayload("GET", "/orders", http.StatusOK, []byte("orders"))
+	server.HandlerStub(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	resp := makeRequest(t, server, "GET", "/users")
+	compareResponse(t, resp, http.StatusTeapot, []byte{})
+
+	for i := 0; i < 2; i++ {
+		server.Restore(baseline)
+
+		cases := []struct {
+			Name           string
+			Method, Path   string
+			ExpectedStatus int
+			ExpectedBody   []byte
+		}{
+			{"Exact", "GET", "/users", http.StatusOK, []byte("users")},
+			{"Pattern", "GET", "/users/1", http.StatusOK, []byte("user")},
+			{"PatternMethodAdded", "POST", "/users/1", http.StatusMethodNotAllowed, []byte{}},
+			{"RouteAdded", "GET", "/orders", http.StatusNotFound, []byte{}},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.Name, func(t *testing.T) {
+				resp := makeRequest(t, server, tc.Method, tc.Path)
+				compareResponse(t, resp, tc.ExpectedStatus, tc.ExpectedBody)
+			})
+		}
+
+		server.RegisterPayload("POST", "/users/{id}", http.StatusCreated, []byte("created"))
+	}
+
+	if server.RequestCount() != 9 {
+		t.Fatalf("Expected request count to be %d, it was %d", 9, server.RequestCount())
+	}
+}
+
+func TestRestoreMaxConnections(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+	server.RegisterPayload("GET", "/hello", http.StatusOK, []byte("hello"))
+
+	baseline := server.Snapshot()
+	server.SetMaxConnections(1)
+
+	conn := dialServer(t, server)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /hello HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	server.Restore(baseline)
+
+	client := http.Client{Timeout: time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(server.Addr() + "/hello")
+	if err != nil {
+		t.Fatalf("Expected a second connection to be served once the limit was restored, got: %s", err)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("hello"))
+}
@@ -0,0 +1,188 @@
+package httpserver_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestStartTLS(t *testing.T) {
+	ca := newTestCA(t)
+
+	server := httpserver.New()
+	err := server.StartTLS(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "fake-server", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer server.Stop()
+	server.RegisterPayload("GET", "/secure", http.StatusOK, []byte("secure"))
+
+	client := http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs:      ca.pool,
+			Certificates: []tls.Certificate{ca.issue(t, "test-client", x509.ExtKeyUsageClientAuth)},
+		},
+	}}
+
+	resp, err := client.Get(server.Addr() + "/secure")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("secure"))
+
+	state := server.RequestTLSNum(0)
+	if state == nil {
+		t.Fatal("Expected TLS connection state to be recorded")
+	}
+	if len(state.PeerCertificates) == 0 || state.PeerCertificates[0].Subject.CommonName != "test-client" {
+		t.Fatalf("Expected client certificate common name to be %s, got %v", "test-client", state.PeerCertificates)
+	}
+
+	t.Run("PlainHTTP", func(t *testing.T) {
+		plain := httpserver.New()
+		plain.Start()
+		defer plain.Stop()
+
+		makeRequest(t, plain, "GET", "/plain")
+		if state := plain.RequestTLSNum(0); state != nil {
+			t.Fatalf("Expected no TLS connection state, got %v", state)
+		}
+	})
+
+	t.Run("NoCertificate", func(t *testing.T) {
+		broken := httpserver.New()
+
+		started := make(chan error, 1)
+		go func() {
+			started <- broken.StartTLS(&tls.Config{})
+		}()
+
+		select {
+		case err := <-started:
+			if err == nil {
+				t.Fatal("Expected StartTLS without a certificate to fail")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected StartTLS without a certificate to return")
+		}
+	})
+}
+
+func TestRequestProtoNum(t *testing.T) {
+	ca := newTestCA(t)
+
+	server := httpserver.New()
+	err := server.StartTLS(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "fake-server", x509.ExtKeyUsageServerAuth)},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer server.Stop()
+	server.RegisterPayload("GET", "/secure", http.StatusOK, []byte("secure"))
+
+	client := http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.pool},
+		ForceAttemptHTTP2: true,
+	}}
+
+	resp, err := client.Get(server.Addr() + "/secure")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	compareResponse(t, resp, http.StatusOK, []byte("secure"))
+
+	if proto := server.RequestProtoNum(0); proto != "HTTP/2.0" {
+		t.Fatalf("Expected proto to be %s, it was %s", "HTTP/2.0", proto)
+	}
+
+	t.Run("PlainHTTP", func(t *testing.T) {
+		plain := httpserver.New()
+		plain.Start()
+		defer plain.Stop()
+
+		makeRequest(t, plain, "GET", "/plain")
+		if proto := plain.RequestProtoNum(0); proto != "HTTP/1.1" {
+			t.Fatalf("Expected proto to be %s, it was %s", "HTTP/1.1", proto)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WaitForRequest blocks until a request for method and path has been
+// recorded, returning it, or until timeout elapses. Requests recorded before
+// the call are considered too.
+func (s *Server) WaitForRequest(method, path string, timeout time.Duration) (*http.Request, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	seen := 0
+	for {
+		request, arrived := s.findRequestFrom(&seen, method, path)
+		if request != nil {
+			return request, true
+		}
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			return nil, false
+		}
+	}
+}
+
+// findRequestFrom looks for a matching request starting at *seen, advancing
+// it past the requests inspected, but not past one still being received.
+// When nothing matches it returns a channel closed on the next received
+// request.
+func (s *Server) findRequestFrom(seen *int, method, path string) (*http.Request, chan struct{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if *seen > len(s.requests) {
+		*seen = 0
+	}
+
+	pending := -1
+	for i := *seen; i < len(s.requests); i++ {
+		if !s.requests[i].received {
+			if pending < 0 {
+				pending = i
+			}
+			continue
+		}
+
+		request := s.requests[i].request
+		if strings.EqualFold(request.Method, method) && request.URL.Path == path {
+			return request, nil
+		}
+	}
+
+	*seen = len(s.requests)
+	if pending >= 0 {
+		*seen = pending
+	}
+
+	return nil, s.arrived
+}
@@ -0,0 +1,87 @@
+package httpserver_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+func TestWaitForRequest(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			resp, err := http.Get(server.Addr() + "/noise")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		resp, err := http.Post(server.Addr()+"/target", "text/plain", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	request, ok := server.WaitForRequest("POST", "/target", time.Second)
+	if !ok {
+		t.Fatal("Expected request to arrive")
+	}
+	compareRequest(t, request, "POST", "/target")
+
+	t.Run("AlreadyRecorded", func(t *testing.T) {
+		request, ok := server.WaitForRequest("post", "/target", 0)
+		if !ok {
+			t.Fatal("Expected recorded request to be found")
+		}
+		compareRequest(t, request, "POST", "/target")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		if _, ok := server.WaitForRequest("GET", "/never", 50*time.Millisecond); ok {
+			t.Fatal("Expected wait to time out")
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("Expected wait to block for the timeout, returned after %s", elapsed)
+		}
+	})
+}
+
+func TestWaitForRequestPastStalledUpload(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	conn := dialServer(t, server)
+	defer conn.Close()
+	fmt.Fprint(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\nstalled")
+
+	start := time.Now()
+	for server.RequestCount() == 0 {
+		if time.Since(start) > time.Second {
+			t.Fatal("Expected the stalled upload to be recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		resp, err := http.Get(server.Addr() + "/target")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	request, ok := server.WaitForRequest("GET", "/target", time.Second)
+	if !ok {
+		t.Fatal("Expected request to arrive")
+	}
+	compareRequest(t, request, "GET", "/target")
+}
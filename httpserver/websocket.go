@@ -0,0 +1,193 @@
+package httpserver
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxFrameSize caps the payload of a frame read from a client, which
+// declares its length up front.
+const maxFrameSize = 16 << 20
+
+// closeMessageTooBig is the close status sent for frames over maxFrameSize.
+const closeMessageTooBig = 1009
+
+var errFrameTooLarge = errors.Errorf("frame exceeds %d bytes", maxFrameSize)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// RegisterWebSocket accepts WebSocket connections on path and records the
+// payload of every data frame the client sends, available through
+// WebSocketFrames. Pings are answered and a close frame is echoed before the
+// connection is closed. Nothing else is sent to the client. Frames over
+// 16 MiB are refused with a 1009 close frame. Requests that aren't WebSocket
+// handshakes get a 400.
+func (s *Server) RegisterWebSocket(path string) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if key == "" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hijacker, ok := rw.(http.Hijacker)
+		if !ok {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-s.stopped:
+				conn.Close()
+			case <-done:
+			}
+		}()
+
+		fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+		if buf.Flush() != nil {
+			return
+		}
+
+		for {
+			opcode, payload, err := readFrame(buf.Reader)
+			if err == errFrameTooLarge {
+				status := make([]byte, 2)
+				binary.BigEndian.PutUint16(status, closeMessageTooBig)
+				writeFrame(buf.Writer, opClose, status)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			switch opcode {
+			case opText, opBinary, opContinuation:
+				s.recordFrame(path, payload)
+			case opPing:
+				writeFrame(buf.Writer, opPong, payload)
+			case opClose:
+				writeFrame(buf.Writer, opClose, payload)
+				return
+			}
+		}
+	}
+
+	s.RegisterHandler("GET", path, handler)
+}
+
+// WebSocketFrames returns the payloads of the data frames received on the
+// WebSocket registered for path, in the order they arrived. Fragments of a
+// message are recorded as separate frames.
+func (s *Server) WebSocketFrames(path string) [][]byte {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([][]byte{}, s.frames[path]...)
+}
+
+func (s *Server) recordFrame(path string, payload []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.frames[path] = append(s.frames[path], payload)
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readFrame reads a single frame sent by a client, unmasking its payload.
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(r, extended); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(r, extended); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	if length > maxFrameSize {
+		return 0, nil, errFrameTooLarge
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// writeFrame writes payload as a single unmasked frame, as servers send them.
+func writeFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	w.WriteByte(0x80 | opcode)
+
+	switch {
+	case len(payload) < 126:
+		w.WriteByte(byte(len(payload)))
+	case len(payload) <= 0xffff:
+		w.WriteByte(126)
+		binary.Write(w, binary.BigEndian, uint16(len(payload)))
+	default:
+		w.WriteByte(127)
+		binary.Write(w, binary.BigEndian, uint64(len(payload)))
+	}
+
+	w.Write(payload)
+	return w.Flush()
+}
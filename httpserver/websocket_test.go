@@ -0,0 +1,109 @@
+package httpserver_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/tscolari/gofakes/httpserver"
+)
+
+// writeClientFrame writes payload as a single masked frame, as clients send
+// them.
+func writeClientFrame(t *testing.T, w io.Writer, opcode byte, payload []byte) {
+	t.Helper()
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	if _, err := w.Write(frame); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// dialWebSocket opens a connection to path and completes the WebSocket
+// handshake on it.
+func dialWebSocket(t *testing.T, server *httpserver.Server, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn := dialServer(t, server)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status code to be %d but it was %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected Sec-WebSocket-Accept to be %s, it was %s", "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", accept)
+	}
+
+	return conn, reader
+}
+
+func TestRegisterWebSocket(t *testing.T) {
+	server := httpserver.New()
+	server.Start()
+	defer server.Stop()
+
+	server.RegisterWebSocket("/ws")
+
+	conn, reader := dialWebSocket(t, server, "/ws")
+	defer conn.Close()
+
+	writeClientFrame(t, conn, 0x1, []byte("hello"))
+	writeClientFrame(t, conn, 0x2, []byte{0x01, 0x02})
+	writeClientFrame(t, conn, 0x8, []byte{0x03, 0xe8})
+
+	closing := make([]byte, 4)
+	if _, err := io.ReadFull(reader, closing); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if closing[0] != 0x88 {
+		t.Fatalf("Expected a close frame, got %x", closing)
+	}
+
+	frames := server.WebSocketFrames("/ws")
+	if len(frames) != 2 || string(frames[0]) != "hello" || string(frames[1]) != "\x01\x02" {
+		t.Fatalf("Expected frames to be %q, got %q", []string{"hello", "\x01\x02"}, frames)
+	}
+
+	t.Run("FrameTooLarge", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, server, "/ws")
+		defer conn.Close()
+
+		header := []byte{0x82, 0x80 | 127, 0x40, 0, 0, 0, 0, 0, 0, 0}
+		if _, err := conn.Write(header); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		closing := make([]byte, 4)
+		if _, err := io.ReadFull(reader, closing); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if expected := []byte{0x88, 0x02, 0x03, 0xf1}; !bytes.Equal(closing, expected) {
+			t.Fatalf("Expected a 1009 close frame %x, got %x", expected, closing)
+		}
+
+		if frames := server.WebSocketFrames("/ws"); len(frames) != 2 {
+			t.Fatalf("Expected %d frames, got %d", 2, len(frames))
+		}
+	})
+
+	t.Run("NotAWebSocket", func(t *testing.T) {
+		resp := makeRequest(t, server, "GET", "/ws")
+		compareResponse(t, resp, http.StatusBadRequest, []byte{})
+	})
+}
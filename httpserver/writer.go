@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// responseRecorder wraps the ResponseWriter given to handlers to keep a copy
+// of the response, while still exposing flushing and hijacking.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+	written    int64
+	skipBody   bool
+	hijacked   bool
+	duration   time.Duration
+}
+
+func newResponseRecorder(rw http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: rw}
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 && statusCode >= 200 {
+		r.statusCode = statusCode
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	n, err := r.ResponseWriter.Write(data)
+	if !r.skipBody {
+		r.body.Write(data[:n])
+	}
+	r.written += int64(n)
+	return n, err
+}
+
+// skipBodyCapture keeps rw, if it is a responseRecorder, from keeping a copy
+// of the response body. The response is then recorded without one.
+func skipBodyCapture(rw http.ResponseWriter) {
+	if recorder, ok := rw.(*responseRecorder); ok {
+		recorder.skipBody = true
+	}
+}
+
+// response returns a copy of what was written, or nil if the connection was
+// hijacked.
+func (r *responseRecorder) response() *Response {
+	if r.hijacked {
+		return nil
+	}
+
+	if r.statusCode == 0 {
+		return &Response{StatusCode: http.StatusOK, Header: r.ResponseWriter.Header().Clone()}
+	}
+
+	return &Response{StatusCode: r.statusCode, Header: r.header, Body: r.body.Bytes()}
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	r.hijacked = true
+	return hijacker.Hijack()
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}